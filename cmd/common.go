@@ -135,7 +135,8 @@ func getConfig() monitor.Config {
 		utils.Exit(1, "Control file '%s' does not exists", cfg.ControlFile)
 	}
 
-	if Foreground {
+	// The init process must stay in the foreground
+	if Foreground || InitMode {
 		cfg.ShouldDaemonize = false
 	} else {
 		cfg.ShouldDaemonize = true
@@ -176,6 +177,8 @@ type serviceCommand struct {
 	cmd           string
 	singleCheckCb func(string) error
 	multicheckCb  func() []error
+	// report optionally describes how the command went for a single check
+	report func(string) string
 }
 
 func (sc *serviceCommand) Execute(arg string) (string, error) {
@@ -198,6 +201,11 @@ func (sc *serviceCommand) Execute(arg string) (string, error) {
 			err = fmt.Errorf("Failed to %s %s: %s", sc.cmd, arg, err.Error())
 		} else {
 			msg = fmt.Sprintf("%s %s", status, arg)
+			if sc.report != nil {
+				if report := sc.report(arg); report != "" {
+					msg = fmt.Sprintf("%s (%s)", msg, report)
+				}
+			}
 		}
 	}
 
@@ -240,6 +248,9 @@ func runCheckCommand(cm interface {
 			singleCheckCb: cm.Stop,
 			multicheckCb:  cm.StopAll,
 		}
+		if r, ok := cm.(monitor.StopReporter); ok {
+			sc.report = r.StopReport
+		}
 	case "restart":
 		sc = &serviceCommand{
 			cmd:           cmd,
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bitnami/gonit/monitor"
+	"github.com/bitnami/gonit/utils"
+)
+
+// Exit codes used when terminating in init mode
+const (
+	// initExitStopped means all the services were stopped
+	initExitStopped = 0
+	// initExitStopFailed means some of the services failed to stop
+	initExitStopFailed = 1
+	// initExitTimeout means the services did not stop within InitStopTimeout
+	// and the remaining ones were killed
+	initExitTimeout = 2
+)
+
+var (
+	// InitMode makes gonit act as the init process of a container, reaping
+	// zombie processes and stopping all the services before exiting
+	InitMode bool
+	// ForwardSignals contains the signals forwarded to the services in init
+	// mode. SIGTERM, SIGINT and SIGCHLD cannot be forwarded, as gonit needs
+	// them to stop the services and reap zombies
+	ForwardSignals []string
+	// InitStopTimeout configures the number of seconds to wait for all the
+	// services to stop when terminating in init mode
+	InitStopTimeout int
+)
+
+func addInitFlags() {
+	RootCmd.Flags().BoolVar(&InitMode, "init", false, "Run as the init process (PID 1) of a container, reaping zombies and stopping all services on termination")
+	RootCmd.Flags().StringSliceVar(&ForwardSignals, "forward-signals", []string{}, "Forward these `signals` to the running services in init mode, except TERM, INT and CHLD")
+	RootCmd.Flags().IntVar(&InitStopTimeout, "stop-timeout", 60, "Wait up to `n` seconds for the services to stop on termination in init mode")
+}
+
+func parseForwardSignals() []syscall.Signal {
+	signals := []syscall.Signal{}
+	for _, name := range ForwardSignals {
+		sig, err := monitor.ParseSignal(name)
+		if err != nil {
+			utils.Exit(1, "Invalid signal to forward: %s", err.Error())
+		}
+		switch sig {
+		case syscall.SIGTERM, syscall.SIGINT, syscall.SIGCHLD:
+			utils.Exit(1, "Invalid signal to forward: %s is handled by gonit", name)
+		}
+		signals = append(signals, sig)
+	}
+	return signals
+}
+
+// shutdown stops all the services and returns the exit code to use
+func shutdown(app *monitor.Monitor) int {
+	code := initExitStopped
+	if err := app.Shutdown(time.Duration(InitStopTimeout) * time.Second); err == monitor.ErrShutdownTimeout {
+		code = initExitTimeout
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		code = initExitStopFailed
+	}
+	app.Terminate()
+	monitor.ReapZombies()
+	return code
+}
+
+func setupInitSignals(app *monitor.Monitor) {
+	forwarded := map[os.Signal]bool{}
+	signals := []os.Signal{syscall.SIGCHLD, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM}
+	for _, sig := range parseForwardSignals() {
+		forwarded[sig] = true
+		signals = append(signals, sig)
+	}
+	if os.Getpid() != 1 {
+		if err := monitor.BecomeSubreaper(); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot become a subreaper, orphaned processes will not be reaped: %s\n", err.Error())
+		}
+	}
+
+	c := make(chan os.Signal, 16)
+	signal.Notify(c, signals...)
+
+	go func() {
+		shuttingDown := false
+		for s := range c {
+			switch {
+			case s == syscall.SIGCHLD:
+				monitor.ReapZombies()
+			// Forwarding SIGHUP takes precedence over reloading
+			case forwarded[s]:
+				app.SignalAll(s.(syscall.Signal))
+			// Reloads and further stop requests are ignored while shutting down
+			case shuttingDown:
+			case s == syscall.SIGHUP:
+				app.Reload()
+			case s == syscall.SIGINT, s == syscall.SIGTERM:
+				// Zombies keep being reaped while the services stop
+				shuttingDown = true
+				go func() {
+					os.Exit(shutdown(app))
+				}()
+			}
+		}
+	}()
+}
@@ -23,6 +23,7 @@ var RootCmd = &cobra.Command{
 
 func init() {
 	addGlobalFlags()
+	addInitFlags()
 }
 
 func setupSignals(app *monitor.Monitor) {
@@ -101,7 +102,11 @@ func RunMonitor(c monitor.Config) {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
-	setupSignals(app)
+	if InitMode {
+		setupInitSignals(app)
+	} else {
+		setupSignals(app)
+	}
 	if app.HTTPServerSupported() {
 		app.StartServer()
 	}
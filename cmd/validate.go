@@ -1,6 +1,29 @@
 package cmd
 
-var validateCmd = unimplementedCommand("validate")
+import (
+	"os"
+
+	"github.com/bitnami/gonit/log"
+	"github.com/bitnami/gonit/monitor"
+	"github.com/bitnami/gonit/utils"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = newValidatedCommand("validate", cobra.Command{
+	Use:   "validate",
+	Short: "Validate the control file",
+	Long:  "Check the control file syntax, including the dependencies between services",
+}, 0, 0, func(cmd *cobra.Command, args []string) {
+	cfg := getConfig()
+	logger := log.DummyLogger()
+	if Verbose {
+		logger = log.StreamLogger(os.Stderr)
+	}
+	if err := monitor.ValidateConfigFile(cfg.ControlFile, logger); err != nil {
+		utils.Exit(1, "Control file '%s' is not valid: %s", cfg.ControlFile, err.Error())
+	}
+	utils.Exit(0, "Control file syntax OK")
+})
 
 func init() {
 	RootCmd.AddCommand(validateCmd)
@@ -797,6 +797,31 @@ func (suite *CmdSuite) TestBasicConfigChecks() {
 	}
 }
 
+func (suite *CmdSuite) TestValidateCommand() {
+	t := suite.T()
+	rootDir := suite.sb.TempFile()
+	suite.RenderScenario("scenario1", rootDir, gt.CfgOpts{
+		Name:    "scenario1",
+		RootDir: rootDir,
+	})
+
+	_, _, _, ctrlFile, stateFile := prepareRootDir(rootDir)
+	flags := []string{"--controlfile", ctrlFile, "--statefile", stateFile}
+
+	gonit(flags, "validate").AssertSuccessMatch(t, "^Control file syntax OK\n$")
+	gonit(flags, "validate", "apache").AssertErrorMatch(t, "Command validate requires exactly 0 arguments but 1 were provided")
+
+	data, err := os.ReadFile(ctrlFile)
+	suite.NoError(err)
+	suite.NoError(os.WriteFile(ctrlFile, append(data, []byte(`
+check process a with pidfile /tmp/a.pid
+  depends on b
+check process b with pidfile /tmp/b.pid
+  depends on a
+`)...), os.FileMode(0600)))
+	gonit(flags, "validate").AssertErrorMatch(t, "Dependency cycle detected: a -> b -> a")
+}
+
 func (suite *CmdSuite) TestStatusCommand() {
 	t := suite.T()
 	rootDir := suite.sb.TempFile()
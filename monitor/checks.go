@@ -1,8 +1,12 @@
 package monitor
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -15,8 +19,8 @@ import (
 	"github.com/bitnami/gonit/utils"
 )
 
-// CheckMaxStartTries defines a global default value for how many failed start attempts are made
-// before automatically unmonitoring a check
+// CheckMaxStartTries defines a global default value for how many start attempts can be made
+// within the last CheckMaxStartTries cycles before automatically unmonitoring a check
 const CheckMaxStartTries = 5
 
 type syncValue struct {
@@ -135,6 +139,19 @@ func restartProcess(p interface {
 }
 
 func doOnce(id string, cb func(), timeout time.Duration, opts Opts) (blocked bool) {
+	run := takeOnce(id, timeout, opts)
+	if run == nil {
+		return true
+	}
+	go run(cb)
+	return false
+}
+
+// takeOnce takes the execution mutex for id, returning a function that
+// calls the provided callback and releases it, or nil if a previous
+// operation is still in process. The mutex expires after timeout counting
+// from the moment the returned function is called
+func takeOnce(id string, timeout time.Duration, opts Opts) func(cb func()) {
 	logger := opts.Logger
 	if logger == nil {
 		logger = log.DummyLogger()
@@ -149,13 +166,13 @@ func doOnce(id string, cb func(), timeout time.Duration, opts Opts) (blocked boo
 	mutex.Unlock()
 	if !s.Take() {
 		logger.Warnf("A previous operation for %s is still in process", id)
-		return true
+		return nil
 	}
 	cleanUp := func() {
 		s.SetInProgressState(false)
 	}
 
-	go func() {
+	return func(cb func()) {
 		timer := time.AfterFunc(timeout, func() {
 			logger.Debugf("Execution mutex for %s expired. Cleaning up...", id)
 			cleanUp()
@@ -165,8 +182,7 @@ func doOnce(id string, cb func(), timeout time.Duration, opts Opts) (blocked boo
 			cleanUp()
 		}()
 		cb()
-	}()
-	return false
+	}
 }
 
 // CheckOnce calls the provided check Perform operation once, ignoring the call
@@ -219,7 +235,30 @@ type check struct {
 	// Monitored configures wether the check is taken into account by the monitor or not.
 	// If not, it won't be automatically started in case of unhandled stops
 	monitored syncBool
-	logger    Logger
+	// DependsOn contains the ids of the checks this one depends on
+	DependsOn []string
+	// Mode configures which automatic actions the monitor takes over the
+	// check (ModeActive, ModePassive or ModeManual). Empty means ModeActive
+	Mode string
+	// OnReboot overrides the global policy applied to the check monitored
+	// status after a reboot if not empty
+	OnReboot string
+	logger   Logger
+	rules    []*rule
+	// owner contains the check type embedding this base check, used
+	// by rule actions
+	owner interface {
+		Checkable
+	}
+	// restartHandler, if not nil, is used by rule actions to restart the
+	// check along with the checks depending on it
+	restartHandler func(interface {
+		CheckableProcess
+	}) error
+	// schedule, if not nil, restricts the monitor cycles in which the check
+	// is performed
+	schedule  *schedule
+	nextCheck syncTime
 }
 
 // GetTimeout returns the check Timeout
@@ -242,7 +281,8 @@ func (c *check) Initialize(opts Opts) {
 	if opts.Logger != nil {
 		c.logger = opts.Logger
 	}
-	c.SetMonitored(true)
+	// Manual checks are not monitored until started through gonit
+	c.SetMonitored(c.getMode() != ModeManual)
 }
 
 func (c *check) getMonitoredString() (str string) {
@@ -286,12 +326,33 @@ func newCheck(id string, kind string) interface {
 	Checkable
 } {
 	check := &check{Timeout: 120 * time.Second, ID: id, logger: log.DummyLogger()}
+	var c interface {
+		Checkable
+	}
 	switch kind {
 	case "process":
-		return &ProcessCheck{check: check}
+		c = &ProcessCheck{check: check}
+	case "file":
+		c = newFileCheck(check)
+	case "fifo":
+		c = newFifoCheck(check)
+	case "directory":
+		c = newDirectoryCheck(check)
+	case "filesystem":
+		c = newFilesystemCheck(check)
+	case "host":
+		c = newHostCheck(check)
+	case "network":
+		c = newNetworkCheck(check)
+	case "program":
+		c = newProgramCheck(check)
+	case "system":
+		c = newSystemCheck(check)
 	default:
-		return check
+		c = check
 	}
+	check.owner = c
+	return c
 }
 
 func newCheckFromData(data string) (interface {
@@ -303,6 +364,12 @@ func newCheckFromData(data string) (interface {
 		kind := match[2]
 		id := match[3]
 		config := match[4]
+		// As in monit, $HOST expands to the name of the host
+		if id == "$HOST" {
+			if hostname, err := os.Hostname(); err == nil {
+				id = hostname
+			}
+		}
 		c := newCheck(id, kind)
 		c.Parse(config)
 		return c, nil
@@ -317,7 +384,17 @@ type Command struct {
 	// Timeout defines the time to wait for the command to trigger
 	// a state change in the check (for example, running to stopped after calling stop)
 	Timeout time.Duration
-	logger  Logger
+	// UID and GID contain the user and group, either names or numeric ids,
+	// the command runs as. The current ones are used if empty
+	UID string
+	GID string
+	// Env contains the "NAME=value" variables added to the environment of
+	// the command, Dir its working directory and Umask its file mode
+	// creation mask, in octal. The ones of the monitor are used if empty
+	Env    []string
+	Dir    string
+	Umask  string
+	logger Logger
 }
 
 func newCommand(cmdStr string, timeout time.Duration, opts Opts) *Command {
@@ -335,9 +412,49 @@ func (c *Command) Exec() {
 	// TODO REPORT error, track std streams
 	c.logger.Debugf("/bin/bash -c %s", c.Cmd)
 
-	cmd := exec.Command("/bin/bash", "-c", c.Cmd)
+	cmd := exec.Command("/bin/bash", "-c", c.shellScript(c.Cmd))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := c.setCredentials(cmd); err != nil {
+		c.logger.Warnf("Cannot execute %q: %s", c.Cmd, err.Error())
+		return
+	}
+	c.setEnvironment(cmd)
+	c.logger.Debug(runChild(cmd))
+}
+
+// Output executes the command and waits for it to finish, returning its
+// combined standard output and error along with its exit code. If the command
+// does not finish before Timeout, its process group is killed and an error returned
+func (c *Command) Output() ([]byte, int, error) {
+	c.logger.Debugf("/bin/bash -c %s", c.Cmd)
+
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", c.shellScript(c.Cmd))
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	c.logger.Debug(cmd.Run())
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	if err := c.setCredentials(cmd); err != nil {
+		return nil, -1, err
+	}
+	c.setEnvironment(cmd)
+	out, err := combinedOutputChild(cmd)
+	if ctx.Err() == context.DeadlineExceeded {
+		return out, -1, fmt.Errorf("Timed out after %v", c.Timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out, exitErr.ExitCode(), nil
+	} else if err != nil {
+		return out, -1, err
+	}
+	return out, 0, nil
 }
 
 func (c *ProcessCheck) getStatusString() (str string) {
@@ -364,12 +481,35 @@ func (c *ProcessCheck) String() string {
 	s := fmt.Sprintf("Process '%s'\n", c.ID)
 	if c.IsMonitored() {
 		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString())
-		if c.IsRunning() {
-			s += fmt.Sprintf("  %-40s %12d\n", "pid", c.Pid())
+		if c.Matching != "" {
+			s += fmt.Sprintf("  %-40s %12s\n", "matching", c.Matching)
+		}
+		s += c.foregroundText()
+		s += c.identityText()
+		if pid := c.Pid(); c.IsRunning() {
+			s += fmt.Sprintf("  %-40s %12d\n", "pid", pid)
+			if st, err := readProcStat(pid); err == nil {
+				s += fmt.Sprintf("  %-40s %12d\n", "parent pid", st.PPid)
+			}
+			if id := c.getIdentity(); id != nil && id.Pid == pid && id.Cmdline != "" {
+				s += fmt.Sprintf("  %-40s %12s\n", "command line", id.Cmdline)
+			}
 		}
 		s += fmt.Sprintf("  %-40s %12v\n", "uptime", utils.RoundDuration(c.Uptime()))
+		if res := c.getResources(); res != nil && c.IsRunning() {
+			s += res.resourcesText()
+		}
+		s += c.programsText()
+		s += c.stopText()
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
 		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
 	} else {
+		s += c.foregroundText()
+		s += c.programsText()
+		s += c.stopText()
+		s += c.modeText()
 		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
 	}
 	return s
@@ -388,9 +528,18 @@ func (c *ProcessCheck) Initialize(opts Opts) {
 		c.StopProgram = newCommand("", c.Timeout, opts)
 	}
 
+	if c.RestartProgram == nil {
+		c.RestartProgram = newCommand("", c.Timeout, opts)
+	}
+
+	if c.ForegroundProgram != nil {
+		c.ForegroundProgram.logger = c.logger
+	}
+
 	// TODO: Is this really needed?
 	c.StartProgram.logger = c.logger
 	c.StopProgram.logger = c.logger
+	c.RestartProgram.logger = c.logger
 
 	if c.StartProgram.Timeout == 0 {
 		c.StartProgram.Timeout = c.Timeout
@@ -398,9 +547,15 @@ func (c *ProcessCheck) Initialize(opts Opts) {
 	if c.StopProgram.Timeout == 0 {
 		c.StopProgram.Timeout = c.Timeout
 	}
+	if c.RestartProgram.Timeout == 0 {
+		c.RestartProgram.Timeout = c.Timeout
+	}
 	if c.IsRunning() {
 		c.startedAt.Set(time.Now())
 	}
+	c.pidChanged.Set(false)
+	c.ppidChanged.Set(false)
+	c.startAttempted.Set(false)
 }
 
 // Perform makes the process check execute its default task. In case of
@@ -409,7 +564,12 @@ func (c *ProcessCheck) Initialize(opts Opts) {
 func (c *ProcessCheck) Perform() {
 	c.logger.Infof("Performing process check %s", c.ID)
 	c.logger.MDebugf(c.String())
-	if c.IsMonitored() && !c.IsRunning() {
+	if c.IsMonitored() && !c.IsRunning() && c.isPassive() {
+		c.logger.Warnf("Service %s is not running. Not starting it in passive mode", c.ID)
+	} else if c.IsMonitored() && !c.IsRunning() && c.startsSuspended() {
+		_, cycles := c.startTriesLimits()
+		c.logger.Warnf("Service %s is not running. Not starting it after %d start attempts within %d cycles", c.ID, c.startTries(), cycles)
+	} else if c.IsMonitored() && !c.IsRunning() {
 		c.logger.Infof("Service %s is not running. Starting...", c.ID)
 		go c.start()
 		iterationTime := 500 * time.Millisecond
@@ -421,15 +581,11 @@ func (c *ProcessCheck) Perform() {
 		iteratorTimer := time.NewTimer(iterationTime)
 		defer iteratorTimer.Stop()
 		i := 0
-		maxTries := c.maxStartTries
-		if maxTries == 0 {
-			maxTries = CheckMaxStartTries
-		}
+		c.recordStartAttempt()
 
 	Loop:
 		for {
 			if c.IsRunning() {
-				c.startTriesCnt.Set(0)
 				c.startedAt.Set(time.Now())
 				c.logger.Debugf("%s successfully started", c.ID)
 				break
@@ -441,24 +597,26 @@ func (c *ProcessCheck) Perform() {
 				iteratorTimer.Reset(iterationTime)
 			case <-timoutTimer.C:
 				//				iteratorTimer.Stop()
-				c.startTriesCnt.Incr()
-				c.logger.Warnf("Timed out waiting for %s to start (%d tries left)", c.ID, maxTries-c.startTriesCnt.Get())
+				c.logger.Warnf("Timed out waiting for %s to start", c.ID)
 				break Loop
 			}
 		}
-
-		if c.startTriesCnt.Get() >= maxTries {
-			c.SetMonitored(false)
-			c.startTriesCnt.Set(0)
-			c.logger.Warnf("%s was unmonitored after %d failed tries", c.ID, CheckMaxStartTries)
-		}
 	}
+	if c.IsMonitored() {
+		c.updateProcessIds()
+		c.updateResources()
+		c.evaluateRules()
+	}
+	c.updateStartAttempts()
 }
 
 // Restart restarts tge service by calling its stop and restart commands and
 // waiting for the checck to be in running status
 func (c *ProcessCheck) Restart() (err error) {
 	c.logger.Debugf("Restarting %s", c.GetID())
+	if c.RestartProgram != nil && c.RestartProgram.Cmd != "" {
+		return c.restartWithProgram()
+	}
 	if err = c.Stop(); err == nil {
 		err = c.Start()
 	}
@@ -468,6 +626,43 @@ func (c *ProcessCheck) Restart() (err error) {
 	return err
 }
 
+// restartWithProgram restarts the process by calling its restart command
+// and waiting for it to be running again. Graceful restarts can keep the
+// same pid, in which case the process is considered restarted once the
+// command finishes
+func (c *ProcessCheck) restartWithProgram() error {
+	c.SetMonitored(true)
+	oldPid := c.Pid()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.RestartProgram.Exec()
+		// Processes restarted in place can run a new executable or command
+		// line, so their identity is recorded again
+		c.identity.Set(nil)
+	}()
+	restarted := func() bool {
+		if c.Pid() == oldPid {
+			select {
+			case <-done:
+			default:
+				return false
+			}
+		}
+		return c.IsRunning()
+	}
+	if !utils.WaitUntil(restarted, c.RestartProgram.Timeout) {
+		return fmt.Errorf("Failed to restart %s", c.GetID())
+	}
+	if pid := c.Pid(); pid == oldPid {
+		c.logger.Infof("%s restarted keeping its pid (%d)", c.GetID(), pid)
+	} else {
+		c.logger.Infof("%s restarted with pid %d", c.GetID(), pid)
+	}
+	c.startedAt.Set(time.Now())
+	return nil
+}
+
 func (c *ProcessCheck) start() {
 	c.logger.Debugf("Starting %s", c.GetID())
 	c.SetMonitored(true)
@@ -481,6 +676,10 @@ func (c *ProcessCheck) start() {
 	defer func() {
 		c.startedAt.Set(time.Now())
 	}()
+	if c.isForeground() {
+		c.spawnForeground()
+		return
+	}
 	c.StartProgram.Exec()
 }
 
@@ -501,29 +700,90 @@ func (c *ProcessCheck) stop() {
 		c.logger.Debugf("%s is already stopped", c.GetID())
 		return
 	}
-	c.StopProgram.Exec()
+	// Foreground processes are stopped with SIGTERM by default
+	if c.StopProgram.Cmd == "" && (c.StopSignal != 0 || c.isForeground()) {
+		pid, sig := c.Pid(), c.StopSignal
+		if sig == 0 {
+			sig = syscall.SIGTERM
+		}
+		if pid <= 0 {
+			c.logger.Warnf("Cannot send %s to %s: unknown pid", signalName(sig), c.GetID())
+			return
+		}
+		c.logger.Debugf("Sending %s to %s (%d)", signalName(sig), c.GetID(), pid)
+		if err := syscall.Kill(pid, sig); err != nil {
+			c.logger.Warnf("Error sending %s to %s: %s", signalName(sig), c.GetID(), err.Error())
+		}
+		return
+	}
+	// Stop programs still running after the stop timeout get their process
+	// group killed, so they do not linger while the stop is escalated
+	out, _, err := c.StopProgram.Output()
+	c.logger.Debug(string(out))
+	if err != nil {
+		c.logger.Warnf("Error running the stop program of %s: %s", c.GetID(), err.Error())
+	}
 }
 
-// Stop stops the  process by calling its stop command and waiting
-// for the checck to be in stopped status
+// Stop stops the  process by calling its stop command, or sending it its
+// StopSignal, and waiting for the checck to be in stopped status. If
+// StopEscalation is enabled, a process still running after the stop timeout
+// gets its process group terminated
 func (c *ProcessCheck) Stop() error {
+	pid := c.Pid()
+	c.stopSteps.Set([]string{})
 	go c.stop()
-	if !utils.WaitUntil(c.IsNotRunning, c.StopProgram.Timeout) {
+	if utils.WaitUntil(c.IsNotRunning, c.StopProgram.Timeout) {
+		return nil
+	}
+	if !c.StopEscalation {
 		return fmt.Errorf("Failed to stop %s", c.GetID())
 	}
-	return nil
+	steps, err := c.escalateStop(pid)
+	c.stopSteps.Set(steps)
+	return err
 }
 
-// Pid returns the pid of the process by reading its pid file.
-// It will return -1 in case of no pid file found or it is malformed
+// Pid returns the pid of the process by reading its pid file or, if a
+// matching pattern is configured, by looking for the oldest process whose
+// command line matches it. Foreground processes pids are tracked in memory.
+// It will return -1 in case of no pid file found, it is malformed or no
+// process matches
 func (c *ProcessCheck) Pid() int {
+	if c.isForeground() {
+		return c.foregroundPid()
+	}
+	if c.matchingRe != nil {
+		return c.matchingPid()
+	}
 	pid, _ := utils.ReadPid(c.PidFile)
 	return pid
 }
 
-// IsRunning returns true if the process is running
+func (c *ProcessCheck) matchingPid() int {
+	matches, err := findMatchingProcesses(c.matchingRe)
+	if err != nil {
+		c.logger.Warnf("Error looking for processes matching %q: %s", c.Matching, err.Error())
+		return -1
+	}
+	if len(matches) == 0 {
+		return -1
+	}
+	if len(matches) > 1 {
+		c.logger.Debugf("%d processes match %q for %s, using the oldest one (%d)", len(matches), c.Matching, c.ID, matches[0].Pid)
+	}
+	return matches[0].Pid
+}
+
+// IsRunning returns true if the process is running and its identity
+// matches the one recorded for its pid
 func (c *ProcessCheck) IsRunning() bool {
-	return utils.IsProcessRunning(c.Pid())
+	pid := c.Pid()
+	if !utils.IsProcessRunning(pid) {
+		c.stalePid.Set("")
+		return false
+	}
+	return c.verifyIdentity(pid)
 }
 
 // IsNotRunning returns true if the process is not running
@@ -545,13 +805,196 @@ func (c *ProcessCheck) Status() (str string) {
 // ProcessCheck defines a service type check
 type ProcessCheck struct {
 	*check
-	Group         string
-	PidFile       string
-	StartProgram  *Command
-	StopProgram   *Command
-	startedAt     syncTime
-	maxStartTries int
-	startTriesCnt syncInt
+	Group   string
+	PidFile string
+	// Matching contains a regular expression identifying the process by its
+	// command line, used instead of PidFile if provided
+	Matching   string
+	matchingRe *regexp.Regexp
+	// Executable, if configured, contains the path of the executable the
+	// process must run to be considered the one of the check
+	Executable string
+	// identity contains the details of the process last seen for the check
+	// and stalePid the pid ignored because it belongs to another process
+	identity     syncValue
+	stalePid     syncValue
+	StartProgram *Command
+	StopProgram  *Command
+	// RestartProgram, if configured, is used to restart the process instead
+	// of calling StopProgram and StartProgram
+	RestartProgram *Command
+	// StopSignal, if not 0, is sent to the process to stop it when there is
+	// no StopProgram
+	StopSignal syscall.Signal
+	// StopEscalation makes Stop send SIGTERM and, after StopGracePeriod,
+	// SIGKILL to the process group if it is still running after the stop timeout
+	StopEscalation  bool
+	StopGracePeriod time.Duration
+	// stopSteps contains the escalation steps taken by the last stop
+	stopSteps syncValue
+	// ForegroundProgram, if configured, is spawned and supervised by the
+	// monitor, which tracks its pid in memory instead of using PidFile
+	ForegroundProgram *Command
+	child             syncValue
+	spawnMutex        sync.Mutex
+	// lastExit describes how the foreground process last exited
+	lastExit   syncValue
+	lastExitAt syncTime
+	startedAt  syncTime
+	// maxStartTries configures how many start attempts can be made within
+	// the last startTriesCycles cycles before giving up on the process, by
+	// unmonitoring it or, if startTriesAction is "timeout", by not starting
+	// it until the attempts fall out of the window
+	maxStartTries    int
+	startTriesCycles int
+	startTriesAction string
+	startAttempts    syncValue
+	startAttempted   syncBool
+	resources        syncValue
+	// lastPid and lastPPid contain the process and parent process ids seen
+	// in the last cycle, 0 if unknown
+	lastPid     syncInt
+	lastPPid    syncInt
+	pidChanged  syncBool
+	ppidChanged syncBool
+}
+
+// updateProcessIds records the identity and the process and parent process
+// ids of the running process, flagging the ids as changed if they differ from
+// the ones seen in the previous cycle
+func (c *ProcessCheck) updateProcessIds() {
+	c.pidChanged.Set(false)
+	c.ppidChanged.Set(false)
+	pid := c.Pid()
+	if pid <= 0 || c.IsNotRunning() {
+		return
+	}
+	c.recordIdentity(pid)
+	st, err := readProcStat(pid)
+	if err != nil {
+		c.logger.Debugf("Error reading process information of %s: %s", c.ID, err.Error())
+		return
+	}
+	for _, id := range []struct {
+		last    *syncInt
+		changed *syncBool
+		current int
+	}{{&c.lastPid, &c.pidChanged, pid}, {&c.lastPPid, &c.ppidChanged, st.PPid}} {
+		if previous := id.last.Get(); previous != 0 && previous != id.current {
+			id.changed.Set(true)
+		}
+		id.last.Set(id.current)
+	}
+}
+
+// startTriesLimits returns the maximum number of start attempts allowed
+// and the number of cycles in which they are counted
+func (c *ProcessCheck) startTriesLimits() (int, int) {
+	if c.maxStartTries == 0 {
+		return CheckMaxStartTries, CheckMaxStartTries
+	}
+	return c.maxStartTries, max(c.startTriesCycles, c.maxStartTries)
+}
+
+func (c *ProcessCheck) getStartAttempts() []bool {
+	if attempts, ok := c.startAttempts.Get().([]bool); ok {
+		return attempts
+	}
+	return []bool{}
+}
+
+// startTries returns the number of start attempts made within the
+// configured cycles
+func (c *ProcessCheck) startTries() int {
+	n := 0
+	for _, attempted := range c.getStartAttempts() {
+		if attempted {
+			n++
+		}
+	}
+	return n
+}
+
+// recordStartAttempt accounts a start made by the monitor in the current cycle
+func (c *ProcessCheck) recordStartAttempt() {
+	c.startAttempted.Set(true)
+}
+
+// startsSuspended returns true if the monitor must not start the process
+// because it reached its start attempts limit with the "timeout" action
+func (c *ProcessCheck) startsSuspended() bool {
+	maxTries, _ := c.startTriesLimits()
+	return c.startTriesAction == "timeout" && c.startTries() >= maxTries
+}
+
+// startAttemptsTracker is implemented by the checks accounting the starts
+// made by the monitor to detect flapping
+type startAttemptsTracker interface {
+	recordStartAttempt()
+	startsSuspended() bool
+}
+
+// recordStartAttempt accounts a start or restart of p made by the monitor,
+// if it tracks them
+func recordStartAttempt(p interface {
+	Checkable
+}) {
+	if t, ok := p.(startAttemptsTracker); ok {
+		t.recordStartAttempt()
+	}
+}
+
+// startsSuspended returns true if p tracks its start attempts and the
+// monitor must not start it
+func startsSuspended(p interface {
+	Checkable
+}) bool {
+	t, ok := p.(startAttemptsTracker)
+	return ok && t.startsSuspended()
+}
+
+// updateStartAttempts closes the current cycle in the start attempts window,
+// unmonitoring the process if it was started too many times, unless its
+// starts are just suspended with the "timeout" action
+func (c *ProcessCheck) updateStartAttempts() {
+	maxTries, cycles := c.startTriesLimits()
+	attempted := c.startAttempted.Get()
+	attempts := append(c.getStartAttempts(), attempted)
+	if len(attempts) > cycles {
+		attempts = attempts[len(attempts)-cycles:]
+	}
+	c.startAttempts.Set(attempts)
+	c.startAttempted.Set(false)
+	tries := c.startTries()
+	if tries < maxTries || !c.IsMonitored() {
+		return
+	}
+	if c.startTriesAction == "timeout" {
+		if attempted {
+			c.logger.Warnf("Not starting %s until its %d start attempts fall out of the last %d cycles", c.ID, tries, cycles)
+		}
+		return
+	}
+	c.SetMonitored(false)
+	c.startAttempts.Set([]bool{})
+	c.logger.Warnf("%s was unmonitored after %d start attempts within %d cycles", c.ID, tries, cycles)
+}
+
+func (c *ProcessCheck) loadState(e *ChecksDatabaseEntry) {
+	c.lastPid.Set(e.Pid)
+	c.lastPPid.Set(e.PPid)
+	c.startAttempts.Set(e.StartAttempts)
+	if e.Identity != nil {
+		c.identity.Set(e.Identity)
+	}
+}
+
+func (c *ProcessCheck) saveState(e *ChecksDatabaseEntry) {
+	e.Pid = c.lastPid.Get()
+	e.PPid = c.lastPPid.Get()
+	e.StartAttempts = c.getStartAttempts()
+	e.Identity = c.getIdentity()
+	e.Foreground = c.foregroundIdentity()
 }
 
 // Uptime returns for how long the process have been running
@@ -559,6 +1002,13 @@ func (c *ProcessCheck) Uptime() time.Duration {
 	if !c.IsMonitored() || !c.IsRunning() {
 		return time.Duration(0)
 	}
+	// Matched processes are not necessarily started by us, so their uptime
+	// is read from the system
+	if c.matchingRe != nil {
+		if startTime, err := processStartTime(c.Pid()); err == nil {
+			return time.Since(startTime)
+		}
+	}
 	if c.startedAt.Get().Equal(time.Time{}) {
 		return time.Duration(0)
 	}
@@ -569,58 +1019,84 @@ func unquote(str string) string {
 	return strings.Trim(str, "\"")
 }
 
+// splitStatements splits a check configuration text into statements, each of
+// them starting with one of the provided patterns. Parsing stops at the first
+// text not matching any of them
+func splitStatements(data string, patterns ...*regexp.Regexp) []string {
+	alternatives := []string{}
+	for _, re := range patterns {
+		alternatives = append(alternatives, re.String())
+	}
+	optRe := regexp.MustCompile(fmt.Sprintf(`^[\s\n]*(%s)`, strings.Join(alternatives, "|")))
+	statements := []string{}
+	toParse := data
+	for {
+		matchIdx := optRe.FindStringSubmatchIndex(toParse)
+		if matchIdx == nil {
+			break
+		}
+		statements = append(statements, strings.TrimSpace(toParse[matchIdx[2]:matchIdx[3]]))
+		toParse = toParse[matchIdx[1]:]
+	}
+	return statements
+}
+
+// matchStatement returns the submatches of re if statement starts with it
+// and nil otherwise
+func matchStatement(re *regexp.Regexp, statement string) []string {
+	if idx := re.FindStringIndex(statement); idx == nil || idx[0] != 0 {
+		return nil
+	}
+	return re.FindStringSubmatch(statement)
+}
+
+var (
+	withTimeoutRe    = regexp.MustCompile(`with\s+timeout\s+([^\s]+)\s+` + durationUnitPattern)
+	startTriesRe     = regexp.MustCompile(`^if\s+(\d+)\s+restarts?\s+within\s+(\d+)\s+cycles?\s+then\s+(unmonitor|timeout)$`)
+	asUIDRe          = regexp.MustCompile(`as\s+uid\s+(\"[^\"]+\"|[^\s]+)`)
+	asGIDRe          = regexp.MustCompile(`(as|and)\s+gid\s+(\"[^\"]+\"|[^\s]+)`)
+	changedPidCondRe = regexp.MustCompile(`^changed\s+(pid|ppid)$`)
+	uptimeCondRe     = regexp.MustCompile(`^uptime\s+` + operatorPattern + `\s+(\d+)\s+` + durationUnitPattern + `$`)
+)
+
 // We should make this generic for all Checks
 func parseWithTimeout(data string) (time.Duration, error) {
-
-	withTimeoutRe := regexp.MustCompile(`with\s+timeout\s+([^\s]+)\s+(millisecond|second|minute|hour|day)s?`)
 	t := withTimeoutRe.FindStringSubmatch(data)
 	if t == nil {
 		return 0, nil
 	}
-
-	n, err := strconv.Atoi(t[1])
-	if err != nil {
-		return 0, err
-	}
-
-	duration := time.Duration(n)
-	unit := strings.ToLower(t[2])
-	switch t[2] {
-	case "millisecond":
-		duration *= time.Millisecond
-	case "second":
-		duration *= time.Second
-	case "minute":
-		duration *= time.Minute
-	case "hour":
-		duration *= time.Hour
-	case "day":
-		duration *= time.Hour * 24
-	default:
-		return 0, fmt.Errorf("Unknown unit %s", unit)
-	}
-	return duration, nil
+	return parseDuration(t[1], t[2])
 }
 
 // Parse reads a string containing a monit-like process configuration text
 // and loads the specified settings
 func (c *ProcessCheck) Parse(data string) {
 
-	withRe := regexp.MustCompile(`with\s+([^\s]+)\s+([^\s]+)`)
-	groupRe := regexp.MustCompile(`group\s+([^\\s]+)`)
+	restartRe := regexp.MustCompile(`restart\s+program\s+=\s+(\"[^\"]+\"|[^\s]+)([^\n]*)`)
 	startRe := regexp.MustCompile(`start\s+program\s+=\s+(\"[^\"]+\"|[^\s]+)([^\n]*)`)
 	stopRe := regexp.MustCompile(`stop\s+program\s+=\s+(\"[^\"]+\"|[^\s]+)([^\n]*)`)
-	ifRe := regexp.MustCompile(`if\s+([^\n]+)`)
+	matchingRe := regexp.MustCompile(`matching\s+(\"[^\"]+\"|[^\s]+)`)
 	processOptRe := regexp.MustCompile(
-		fmt.Sprintf(`^[\s\n]*(%s|%s|%s|%s|%s)`,
+		fmt.Sprintf(`^[\s\n]*(%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s)`,
+			matchingRe.String(),
 			groupRe.String(),
+			restartRe.String(),
 			startRe.String(),
 			stopRe.String(),
+			stopSignalRe.String(),
+			stopEscalationRe.String(),
 			ifRe.String(),
+			withCommandRe.String(),
+			withSettingsRe.String(),
 			withRe.String(),
+			everyRe.String(),
+			dependsRe.String(),
+			modeRe.String(),
+			onRebootRe.String(),
 		))
 
 	toParse := data
+	settings := &Command{}
 
 	for {
 		matchIdx := processOptRe.FindStringSubmatchIndex(toParse)
@@ -634,35 +1110,169 @@ func (c *ProcessCheck) Parse(data string) {
 
 		// TODO: Unify startRe and stopRe
 		switch {
-		case groupRe.MatchString(statement):
+		case startTriesRe.MatchString(statement):
+			m := startTriesRe.FindStringSubmatch(statement)
+			c.maxStartTries, _ = strconv.Atoi(m[1])
+			c.startTriesCycles, _ = strconv.Atoi(m[2])
+			c.startTriesAction = m[3]
+			if c.maxStartTries < 1 || c.startTriesCycles < c.maxStartTries {
+				c.logger.Warnf("Ignoring invalid restart limit for %s: %q", c.ID, statement)
+				c.maxStartTries, c.startTriesCycles, c.startTriesAction = 0, 0, ""
+			}
+		case matchStatement(everyRe, statement) != nil:
+			c.parseSchedule(statement)
+		case matchStatement(dependsRe, statement) != nil:
+			c.parseDependencies(statement)
+		case matchStatement(modeRe, statement) != nil:
+			c.parseMode(statement)
+		case matchStatement(onRebootRe, statement) != nil:
+			c.parseOnReboot(statement)
+		case matchStatement(ifRe, statement) != nil:
+			r, err := parseRule(statement, c.parseCondition)
+			if err != nil {
+				c.logger.Warnf("Ignoring rule for %s: %s", c.ID, err.Error())
+				continue
+			}
+			c.rules = append(c.rules, r)
+		case matchStatement(matchingRe, statement) != nil:
+			m := matchingRe.FindStringSubmatch(statement)
+			pattern := unquote(m[1])
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				c.logger.Warnf("Invalid matching pattern %q: %s", pattern, err.Error())
+				continue
+			}
+			c.Matching = pattern
+			c.matchingRe = re
+		case matchStatement(groupRe, statement) != nil:
 			m := groupRe.FindStringSubmatch(statement)
 			c.Group = unquote(m[1])
-		case startRe.MatchString(statement):
+		// Must be checked before startRe, which also matches it
+		case matchStatement(restartRe, statement) != nil:
+			m := restartRe.FindStringSubmatch(statement)
+			c.RestartProgram = c.parseProgram(m[1], m[2])
+		case matchStatement(startRe, statement) != nil:
 			m := startRe.FindStringSubmatch(statement)
-			cmdStr := unquote(m[1])
-			timeout, err := parseWithTimeout(m[2])
-			if err != nil {
-				c.logger.Warnf(err.Error())
-			}
-			c.StartProgram = newCommand(cmdStr, timeout, Opts{Logger: c.logger})
-		case stopRe.MatchString(statement):
+			c.StartProgram = c.parseProgram(m[1], m[2])
+		case matchStatement(stopRe, statement) != nil:
 			m := stopRe.FindStringSubmatch(statement)
-			cmdStr := unquote(m[1])
-			timeout, err := parseWithTimeout(m[2])
-			if err != nil {
-				c.logger.Warnf(err.Error())
+			c.StopProgram = c.parseProgram(m[1], m[2])
+		case matchStatement(stopSignalRe, statement) != nil:
+			c.parseStopSignal(statement)
+		case matchStatement(stopEscalationRe, statement) != nil:
+			c.parseStopEscalation(statement)
+		// Must be checked before withRe, which also matches it
+		case matchStatement(withCommandRe, statement) != nil:
+			m := withCommandRe.FindStringSubmatch(statement)
+			c.ForegroundProgram = c.parseProgram(m[1], m[2])
+		case matchStatement(withSettingsRe, statement) != nil:
+			if err := settings.parseSettings(statement); err != nil {
+				c.logger.Warnf("Ignoring settings for %s: %s", c.ID, err.Error())
 			}
-			c.StopProgram = newCommand(cmdStr, timeout, Opts{Logger: c.logger})
-		case withRe.MatchString(statement):
+		case matchStatement(withRe, statement) != nil:
 			m := withRe.FindStringSubmatch(statement)
 			withKind := m[1]
-			if withKind == "pidfile" {
+			switch withKind {
+			case "pidfile":
 				c.PidFile = unquote(m[2])
-			} else {
+			case "executable":
+				c.Executable = unquote(m[2])
+			default:
 				c.logger.Warnf("Don't know how to interpret \"with %s\"", withKind)
 			}
 		default:
 			c.logger.Debugf("Ignoring statement %s", statement)
 		}
 	}
+	for _, cmd := range []*Command{c.StartProgram, c.StopProgram, c.RestartProgram, c.ForegroundProgram} {
+		cmd.inheritSettings(settings)
+	}
+}
+
+// parseProgram returns the command configured by a start, stop or restart
+// program statement, or by a "with command" one, reading its "as uid",
+// "and gid", "with timeout", "with environment", "with workdir" and "with
+// umask" options
+func (c *ProcessCheck) parseProgram(cmdStr string, options string) *Command {
+	timeout, err := parseWithTimeout(options)
+	if err != nil {
+		c.logger.Warnf(err.Error())
+	}
+	cmd := newCommand(unquote(cmdStr), timeout, Opts{Logger: c.logger})
+	if m := asUIDRe.FindStringSubmatch(options); m != nil {
+		cmd.UID = unquote(m[1])
+	}
+	if m := asGIDRe.FindStringSubmatch(options); m != nil {
+		cmd.GID = unquote(m[2])
+	}
+	if err := cmd.parseSettings(options); err != nil {
+		c.logger.Warnf("Ignoring settings of %q for %s: %s", cmd.Cmd, c.ID, err.Error())
+	}
+	return cmd
+}
+
+// validate ensures the executable and the programs working directories are
+// absolute paths and the users and groups the programs run as exist
+func (c *ProcessCheck) validate() error {
+	if c.isForeground() && (c.PidFile != "" || c.Matching != "") {
+		return fmt.Errorf("Process %s cannot use a command along with a pidfile or matching pattern", c.ID)
+	}
+	if c.Executable != "" && !filepath.IsAbs(c.Executable) {
+		return fmt.Errorf("Process %s executable must be an absolute path: %s", c.ID, c.Executable)
+	}
+	for _, cmd := range []*Command{c.StartProgram, c.StopProgram, c.RestartProgram, c.ForegroundProgram} {
+		if cmd == nil {
+			continue
+		}
+		if _, _, err := cmd.credential(); err != nil {
+			return fmt.Errorf("Invalid program for %s: %s", c.ID, err.Error())
+		}
+		if cmd.Dir != "" && !filepath.IsAbs(cmd.Dir) {
+			return fmt.Errorf("Invalid program for %s: working directory must be an absolute path: %s", c.ID, cmd.Dir)
+		}
+	}
+	return nil
+}
+
+func (c *ProcessCheck) parseCondition(text string) (*condition, error) {
+	switch {
+	case existenceCondRe.MatchString(text):
+		return &condition{Text: text, Failure: "Does not exist", test: func() (bool, string) {
+			return c.IsNotRunning(), "process is not running"
+		}}, nil
+	case changedPidCondRe.MatchString(text):
+		kind := changedPidCondRe.FindStringSubmatch(text)[1]
+		changed, last, failure := &c.pidChanged, &c.lastPid, "PID changed"
+		if kind == "ppid" {
+			changed, last, failure = &c.ppidChanged, &c.lastPPid, "PPID changed"
+		}
+		return &condition{Text: text, Failure: failure, test: func() (bool, string) {
+			return changed.Get(), fmt.Sprintf("%s changed -- current %s is %d", kind, kind, last.Get())
+		}}, nil
+	case uptimeCondRe.MatchString(text):
+		m := uptimeCondRe.FindStringSubmatch(text)
+		op := m[1]
+		limit, err := parseDuration(m[2], m[3])
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Text: text, Failure: "Uptime failed", test: func() (bool, string) {
+			if c.IsNotRunning() {
+				return false, ""
+			}
+			uptime := c.Uptime()
+			return compare(op, float64(uptime), float64(limit)),
+				fmt.Sprintf("uptime test failed -- current uptime is %v", utils.RoundDuration(uptime))
+		}}, nil
+	}
+	if cond, err := c.parseResourceCondition(text); err != nil || cond != nil {
+		return cond, err
+	}
+	pt, err := parsePortTest(text)
+	if err != nil {
+		return nil, err
+	} else if pt != nil {
+		return newPortCondition(text, pt), nil
+	}
+	return nil, fmt.Errorf("Unknown condition %q", text)
 }
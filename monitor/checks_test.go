@@ -2,13 +2,33 @@ package monitor
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	tu "github.com/bitnami/gonit/testutils"
+	"github.com/bitnami/gonit/utils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// newTestCheck parses data into an initialized check of type T
+func newTestCheck[T Checkable](t *testing.T, data string) T {
+	t.Helper()
+	c, err := newCheckFromData(data)
+	require.NoError(t, err)
+	tc, ok := c.(T)
+	require.True(t, ok, "Expected a %T but got %T", tc, c)
+	tc.Initialize(Opts{})
+	return tc
+}
+
 type dummyService struct {
 	sync.RWMutex
 	ProcessCheck
@@ -189,3 +209,266 @@ func TestCheckOnceTwoChecksWithSameId(t *testing.T) {
 			"Expected the number of times called to be %d but got %d", maxCalls, tc)
 	}
 }
+
+func startSleeper(t *testing.T, arg string) *exec.Cmd {
+	cmd := exec.Command("sleep", arg)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return cmd
+}
+
+func TestProcessCheckMatching(t *testing.T) {
+	marker := fmt.Sprintf("%d.%d", 1000+os.Getpid()%1000, time.Now().UnixNano()%1000)
+	c, err := newCheckFromData(fmt.Sprintf(`check process sleeper matching "^sleep %s$"
+  start program = "/bin/true"
+`, regexp.QuoteMeta(marker)))
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	assert.Equal(t, fmt.Sprintf("^sleep %s$", regexp.QuoteMeta(marker)), pc.Matching)
+	assert.Equal(t, -1, pc.Pid())
+	assert.False(t, pc.IsRunning())
+
+	older := startSleeper(t, marker)
+	// Ensure both processes have a different start time
+	time.Sleep(50 * time.Millisecond)
+	startSleeper(t, marker)
+	require.True(t, utils.WaitUntil(pc.IsRunning, 2*time.Second))
+	assert.Equal(t, older.Process.Pid, pc.Pid())
+	assert.True(t, pc.Uptime() > 0)
+	assert.Regexp(t, regexp.MustCompile(fmt.Sprintf(`matching\s+.*\n\s+pid\s+%d\n`, older.Process.Pid)), pc.String())
+
+	older.Process.Kill()
+	older.Wait()
+	assert.NotEqual(t, older.Process.Pid, pc.Pid())
+	assert.True(t, pc.IsRunning())
+}
+
+func TestProcessCheckProgramWithMatchingArgument(t *testing.T) {
+	c, err := newCheckFromData(`check process app with pidfile /tmp/app.pid
+  start program = "/usr/bin/app --matching foo"
+`)
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	assert.Equal(t, "", pc.Matching)
+	assert.Nil(t, pc.matchingRe)
+	assert.Equal(t, "/usr/bin/app --matching foo", pc.StartProgram.Cmd)
+
+	// Nor are group, start or stop program statements found inside others
+	c, err = newCheckFromData(`check process app with pidfile /tmp/app.pid
+  start program = "/usr/bin/app --group web"
+  stop program = "/usr/bin/appctl start program = /bin/false"
+`)
+	require.NoError(t, err)
+	pc = c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	assert.Equal(t, "", pc.Group)
+	assert.Equal(t, "/usr/bin/app --group web", pc.StartProgram.Cmd)
+	assert.Equal(t, "/usr/bin/appctl start program = /bin/false", pc.StopProgram.Cmd)
+}
+
+func TestReadProcStat(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	procDir, _ = sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	pidDir, _ := sb.Mkdir(filepath.Join(procDir, "42"), os.FileMode(0755))
+	sb.Write(filepath.Join(pidDir, "stat"), "42 (my (weird) cmd) S 1 42 42 0 -1 4194560 10 0 0 0 1 2 0 0 20 0 1 0 12345 1000 100 18446744073709551615\n")
+	sb.Write(filepath.Join(pidDir, "cmdline"), "/usr/bin/cmd\x00--flag\x00")
+	sb.Write(filepath.Join(procDir, "stat"), "cpu  1 2 3 4\nbtime 1700000000\n")
+
+	st, err := readProcStat(42)
+	require.NoError(t, err)
+	assert.Equal(t, &procStat{Pid: 42, Comm: "my (weird) cmd", State: "S", PPid: 1, UTime: 1, STime: 2, StartTime: 12345}, st)
+	cmdline, err := readProcCmdline(42)
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/cmd --flag", cmdline)
+	startTime, err := processStartTime(42)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000+123, 450*int64(time.Millisecond)), startTime)
+
+	// Start times after years of uptime do not overflow
+	sb.Write(filepath.Join(pidDir, "stat"), "42 (cmd) S 1 42 42 0 -1 4194560 10 0 0 0 1 2 0 0 20 0 1 0 10000000050 1000 100 0\n")
+	startTime, err = processStartTime(42)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000+100000000, 500*int64(time.Millisecond)), startTime)
+
+	matches, err := findMatchingProcesses(regexp.MustCompile(`--flag`))
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, 42, matches[0].Pid)
+}
+
+func TestProcessCheckPidChanges(t *testing.T) {
+	pidFile := sb.TempFile()
+	flagFile := sb.TempFile()
+	c, err := newCheckFromData(fmt.Sprintf(`check process web with pidfile %s
+  start program = "/bin/true"
+  if changed pid then alert
+  if changed ppid then exec "touch %s"
+`, pidFile, flagFile))
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	require.Len(t, pc.rules, 2)
+	pc.Initialize(Opts{})
+
+	first, second := startSleeper(t, "30"), startSleeper(t, "30")
+	for i, step := range []struct {
+		pid         int
+		pidChanged  bool
+		ppidChanged bool
+	}{
+		{first.Process.Pid, false, false},
+		{first.Process.Pid, false, false},
+		{second.Process.Pid, true, false},
+		// The test process has a different parent than the sleepers
+		{os.Getpid(), true, true},
+	} {
+		sb.Write(pidFile, strconv.Itoa(step.pid))
+		pc.Perform()
+		assert.Equal(t, step.pidChanged, pc.rules[0].matched.Get(), "Unexpected pid change in step %d", i)
+		assert.Equal(t, step.ppidChanged, pc.rules[1].matched.Get(), "Unexpected ppid change in step %d", i)
+	}
+	assert.True(t, utils.FileExists(flagFile))
+	assert.Regexp(t, regexp.MustCompile(fmt.Sprintf(`\n\s+pid\s+%d\n\s+parent pid\s+%d\n`, os.Getpid(), os.Getppid())), pc.String())
+
+	// The last seen ids survive monitor restarts
+	e := &ChecksDatabaseEntry{}
+	pc.saveState(e)
+	assert.Equal(t, os.Getpid(), e.Pid)
+	assert.Equal(t, os.Getppid(), e.PPid)
+	e.Pid = first.Process.Pid
+	pc.loadState(e)
+	pc.Perform()
+	assert.True(t, pc.rules[0].matched.Get())
+	assert.False(t, pc.rules[1].matched.Get())
+}
+
+func TestProcessCheckStartTries(t *testing.T) {
+	c, err := newCheckFromData(`check process web with pidfile /tmp/web.pid
+  if 2 restarts within 3 cycles then timeout
+`)
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	assert.Len(t, pc.rules, 0)
+	tries, cycles := pc.startTriesLimits()
+	assert.Equal(t, 2, tries)
+	assert.Equal(t, 3, cycles)
+
+	for i, attempted := range []bool{true, false, false, true, false} {
+		if attempted {
+			pc.recordStartAttempt()
+		}
+		pc.updateStartAttempts()
+		assert.True(t, pc.IsMonitored(), "Unexpectedly unmonitored in cycle %d", i)
+	}
+	assert.Equal(t, 1, pc.startTries())
+
+	// Counters survive monitor restarts
+	e := &ChecksDatabaseEntry{}
+	pc.saveState(e)
+	assert.Equal(t, []bool{false, true, false}, e.StartAttempts)
+	pc.startAttempts.Set(nil)
+	pc.loadState(e)
+	pc.recordStartAttempt()
+	pc.updateStartAttempts()
+
+	// The timeout action keeps the check monitored, not starting the process
+	// until the attempts fall out of the window
+	assert.True(t, pc.IsMonitored())
+	assert.True(t, pc.startsSuspended())
+	pc.updateStartAttempts()
+	assert.False(t, pc.startsSuspended())
+
+	c, err = newCheckFromData("check process web with pidfile /tmp/web.pid\n  if 2 restarts within 3 cycles then unmonitor\n")
+	require.NoError(t, err)
+	pc = c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	for range 2 {
+		pc.recordStartAttempt()
+		pc.updateStartAttempts()
+	}
+	assert.False(t, pc.IsMonitored())
+	assert.False(t, pc.startsSuspended())
+	assert.Equal(t, 0, pc.startTries())
+
+	c, err = newCheckFromData("check process web with pidfile /tmp/web.pid\n  if 3 restarts within 2 cycles then unmonitor\n")
+	require.NoError(t, err)
+	tries, cycles = c.(*ProcessCheck).startTriesLimits()
+	assert.Equal(t, CheckMaxStartTries, tries)
+	assert.Equal(t, CheckMaxStartTries, cycles)
+}
+
+func TestProcessCheckRestartsCountAsStartTries(t *testing.T) {
+	c, err := newCheckFromData(`check process web with pidfile /tmp/web.pid
+  start program = "/bin/true" with timeout 100 milliseconds
+  if 2 restarts within 3 cycles then timeout
+`)
+	require.NoError(t, err)
+	app, err := New(Config{})
+	require.NoError(t, err)
+	require.NoError(t, app.AddCheck(c))
+	pc := c.(*ProcessCheck)
+
+	// Restarts triggered by rules
+	for i := 1; i <= 2; i++ {
+		pc.runAction(&ruleAction{Name: "restart"})
+		pc.updateStartAttempts()
+		assert.Equal(t, i, pc.startTries())
+	}
+	assert.True(t, pc.startsSuspended())
+
+	// Further starts are not attempted
+	pc.runAction(&ruleAction{Name: "start"})
+	pc.updateStartAttempts()
+	assert.Equal(t, 2, pc.startTries())
+}
+
+func TestProcessCheckRestartProgram(t *testing.T) {
+	pidFile := sb.TempFile()
+	restartedFile := sb.TempFile()
+	script := writeScript(t, fmt.Sprintf("touch %s\n", restartedFile))
+	c, err := newCheckFromData(fmt.Sprintf(`check process web with pidfile %s
+  start program = "/bin/false"
+  stop program = "/bin/false"
+  restart program = %q with timeout 2 seconds
+`, pidFile, script))
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	assert.Equal(t, script, pc.RestartProgram.Cmd)
+	assert.Equal(t, 2*time.Second, pc.RestartProgram.Timeout)
+	assert.Equal(t, "/bin/false", pc.StartProgram.Cmd)
+
+	// Graceful restarts keep the same pid
+	sleeper := startSleeper(t, "30")
+	sb.Write(pidFile, strconv.Itoa(sleeper.Process.Pid))
+	require.NoError(t, pc.Restart())
+	assert.True(t, utils.FileExists(restartedFile))
+	assert.Equal(t, sleeper.Process.Pid, pc.Pid())
+}
+
+func TestProcessCheckRestartProgramNewPid(t *testing.T) {
+	pidFile := sb.TempFile()
+	script := writeScript(t, fmt.Sprintf("sleep 30 >/dev/null 2>&1 &\necho $! > %s\n", pidFile))
+	c, err := newCheckFromData(fmt.Sprintf(`check process web with pidfile %s
+  restart program = %q with timeout 2 seconds
+`, pidFile, script))
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	sleeper := startSleeper(t, "30")
+	sb.Write(pidFile, strconv.Itoa(sleeper.Process.Pid))
+	require.NoError(t, pc.Restart())
+	newPid := pc.Pid()
+	defer syscall.Kill(newPid, syscall.SIGKILL)
+	assert.NotEqual(t, sleeper.Process.Pid, newPid)
+	assert.True(t, pc.IsRunning())
+
+	// The process must be running after the restart program finishes
+	pc.RestartProgram = newCommand(fmt.Sprintf("rm -f %s", pidFile), 500*time.Millisecond, Opts{})
+	tu.AssertErrorMatch(t, pc.Restart(), regexp.MustCompile(`Failed to restart web`))
+}
@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	operatorPattern     = `(>=|<=|==|!=|<>|>|<|=|gt|lt|eq|ne)`
+	durationUnitPattern = `((?i)millisecond|second|minute|hour|day)s?`
+	sizeUnitPattern     = `((?i)b|bytes?|kb?|kilobytes?|mb?|megabytes?|gb?|gigabytes?|tb?|terabytes?)`
+)
+
+var (
+	ifRe      = regexp.MustCompile(`if\s+[^\n]+(\n\s*(then|else)\s+[^\n]+)*`)
+	groupRe   = regexp.MustCompile(`group\s+([^\s]+)`)
+	withRe    = regexp.MustCompile(`with\s+([^\s]+)\s+(\"[^\"]+\"|[^\s]+)`)
+	sizeUnits = map[string]float64{
+		"b":  1,
+		"kb": 1024,
+		"mb": 1024 * 1024,
+		"gb": 1024 * 1024 * 1024,
+		"tb": 1024 * 1024 * 1024 * 1024,
+	}
+)
+
+// condition defines a test evaluated on every check cycle.
+// The test returns true when the condition is met (the monitored
+// resource is in a failed state) along with a message describing it
+type condition struct {
+	// Text contains the condition as written in the configuration file
+	Text string
+	// Failure contains the short status text reported while the condition is met
+	Failure string
+	test    func() (bool, string)
+}
+
+// Test evaluates the condition
+func (cond *condition) Test() (bool, string) {
+	return cond.test()
+}
+
+func (cond *condition) String() string {
+	return cond.Text
+}
+
+// parseStatements reads the "if" rules, "every" schedule, "depends on", "mode",
+// "onreboot" and "with" settings of a check configuration text. Rule conditions are interpreted by parseCondition
+// while parseWith is called for every "with" setting, returning false
+// if it is unknown. The "with timeout" setting configures the check Timeout
+func (c *check) parseStatements(data string, parseCondition func(string) (*condition, error), parseWith func(kind, value string) bool) {
+	for _, statement := range splitStatements(data, groupRe, ifRe, withTimeoutRe, withRe, everyRe, dependsRe, modeRe, onRebootRe) {
+		if m := matchStatement(ifRe, statement); m != nil {
+			r, err := parseRule(statement, parseCondition)
+			if err != nil {
+				c.logger.Warnf("Ignoring rule for %s: %s", c.ID, err.Error())
+				continue
+			}
+			c.rules = append(c.rules, r)
+		} else if m := matchStatement(everyRe, statement); m != nil {
+			c.parseSchedule(statement)
+		} else if m := matchStatement(dependsRe, statement); m != nil {
+			c.parseDependencies(statement)
+		} else if m := matchStatement(modeRe, statement); m != nil {
+			c.parseMode(statement)
+		} else if m := matchStatement(onRebootRe, statement); m != nil {
+			c.parseOnReboot(statement)
+		} else if m := matchStatement(withTimeoutRe, statement); m != nil {
+			timeout, err := parseWithTimeout(statement)
+			if err != nil {
+				c.logger.Warnf(err.Error())
+				continue
+			}
+			c.Timeout = timeout
+		} else if m := matchStatement(withRe, statement); m != nil {
+			if !parseWith(m[1], unquote(m[2])) {
+				c.logger.Warnf("Don't know how to interpret \"with %s\"", m[1])
+			}
+		} else {
+			c.logger.Debugf("Ignoring statement %s", statement)
+		}
+	}
+}
+
+// compare returns the result of applying the operator op to a and b
+func compare(op string, a, b float64) bool {
+	switch op {
+	case ">", "gt":
+		return a > b
+	case "<", "lt":
+		return a < b
+	case ">=":
+		return a >= b
+	case "<=":
+		return a <= b
+	case "=", "==", "eq":
+		return a == b
+	case "!=", "<>", "ne":
+		return a != b
+	}
+	return false
+}
+
+// parseDuration returns the duration represented by a number of units
+// (for example, 15 minutes)
+func parseDuration(number string, unit string) (time.Duration, error) {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return 0, err
+	}
+	duration := time.Duration(n)
+	unit = strings.TrimSuffix(strings.ToLower(unit), "s")
+	switch unit {
+	case "millisecond":
+		duration *= time.Millisecond
+	case "second":
+		duration *= time.Second
+	case "minute":
+		duration *= time.Minute
+	case "hour":
+		duration *= time.Hour
+	case "day":
+		duration *= time.Hour * 24
+	default:
+		return 0, fmt.Errorf("Unknown unit %s", unit)
+	}
+	return duration, nil
+}
+
+// parseSize returns the number of bytes represented by a number of units
+// (for example, 100 MB)
+func parseSize(number string, unit string) (float64, error) {
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, err
+	}
+	unit = strings.ToLower(unit)
+	if unit == "" || unit == "b" || strings.HasPrefix(unit, "byte") {
+		return n, nil
+	}
+	multiplier, ok := sizeUnits[unit[0:1]+"b"]
+	if !ok {
+		return 0, fmt.Errorf("Unknown unit %s", unit)
+	}
+	return n * multiplier, nil
+}
+
+// formatSize returns a human readable representation of a number of bytes
+func formatSize(bytes float64) string {
+	for _, unit := range []string{"TB", "GB", "MB", "kB"} {
+		if multiplier := sizeUnits[strings.ToLower(unit)]; bytes >= multiplier {
+			return fmt.Sprintf("%.1f %s", bytes/multiplier, unit)
+		}
+	}
+	return fmt.Sprintf("%.0f B", bytes)
+}
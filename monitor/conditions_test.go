@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	for text, expected := range map[[2]string]float64{
+		{"100", ""}:         100,
+		{"100", "B"}:        100,
+		{"2", "kb"}:         2048,
+		{"1.5", "MB"}:       1.5 * 1024 * 1024,
+		{"2", "gigabytes"}:  2 * 1024 * 1024 * 1024,
+		{"1", "T"}:          1024 * 1024 * 1024 * 1024,
+		{"10", "kilobytes"}: 10 * 1024,
+	} {
+		size, err := parseSize(text[0], text[1])
+		assert.NoError(t, err)
+		assert.Equal(t, expected, size, "Unexpected size for %s %s", text[0], text[1])
+	}
+	_, err := parseSize("10", "parsecs")
+	assert.Error(t, err)
+}
+
+func TestParseDuration(t *testing.T) {
+	for text, expected := range map[[2]string]time.Duration{
+		{"500", "milliseconds"}: 500 * time.Millisecond,
+		{"5", "second"}:         5 * time.Second,
+		{"15", "Minutes"}:       15 * time.Minute,
+		{"2", "days"}:           48 * time.Hour,
+	} {
+		d, err := parseDuration(text[0], text[1])
+		assert.NoError(t, err)
+		assert.Equal(t, expected, d)
+	}
+	_, err := parseDuration("5", "weeks")
+	assert.Error(t, err)
+}
+
+func TestCompare(t *testing.T) {
+	for _, op := range []string{">", "gt", ">=", "!=", "<>", "ne"} {
+		assert.True(t, compare(op, 2, 1), "Expected 2 %s 1", op)
+	}
+	for _, op := range []string{"<", "lt", "<=", "=", "==", "eq"} {
+		assert.False(t, compare(op, 2, 1), "Expected not 2 %s 1", op)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 kB", formatSize(1536))
+	assert.Equal(t, "2.0 GB", formatSize(2*1024*1024*1024))
+}
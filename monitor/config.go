@@ -28,11 +28,23 @@ type configLoader struct {
 }
 
 func (cl *configLoader) SetAttribute(key, value string) {
-	cl.Logger.Debugf("Ignoring attempt to set %s = %s\n", key, value)
+	switch key {
+	case "onreboot":
+		if err := cl.app.setOnReboot(value); err != nil {
+			cl.Logger.Warnf(err.Error())
+		}
+	default:
+		cl.Logger.Debugf("Ignoring attempt to set %s = %s\n", key, value)
+	}
 }
 func (cl *configLoader) AddCheck(c interface {
 	Checkable
 }) error {
+	if vc, ok := c.(validatableCheck); ok {
+		if err := vc.validate(); err != nil {
+			return err
+		}
+	}
 	return cl.app.AddCheck(c)
 }
 
@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/bitnami/gonit/utils"
+)
+
+func parseID(id string) (uint32, error) {
+	n, err := strconv.ParseUint(id, 10, 32)
+	return uint32(n), err
+}
+
+// credential resolves the user and group the command runs as, along with
+// the home directory of the user. It returns a nil credential if the
+// command runs as the current user
+func (c *Command) credential() (*syscall.Credential, string, error) {
+	if c.UID == "" && c.GID == "" {
+		return nil, "", nil
+	}
+	cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid()), Groups: []uint32{}}
+	home := ""
+	if c.UID != "" {
+		u, err := utils.LookupUser(c.UID)
+		if err != nil {
+			return nil, "", err
+		}
+		if cred.Uid, err = parseID(u.Uid); err != nil {
+			return nil, "", err
+		}
+		if cred.Gid, err = parseID(u.Gid); err != nil {
+			return nil, "", err
+		}
+		groupIds, err := u.GroupIds()
+		if err != nil {
+			return nil, "", fmt.Errorf("Cannot read groups of user %q: %s", c.UID, err.Error())
+		}
+		for _, id := range groupIds {
+			gid, err := parseID(id)
+			if err != nil {
+				return nil, "", err
+			}
+			cred.Groups = append(cred.Groups, gid)
+		}
+		home = u.HomeDir
+	}
+	if c.GID != "" {
+		g, err := utils.LookupGroup(c.GID)
+		if err != nil {
+			return nil, "", err
+		}
+		if cred.Gid, err = parseID(g.Gid); err != nil {
+			return nil, "", err
+		}
+	}
+	return cred, home, nil
+}
+
+// setCredentials configures cmd to run as the command user and group
+func (c *Command) setCredentials(cmd *exec.Cmd) error {
+	cred, home, err := c.credential()
+	if err != nil || cred == nil {
+		return err
+	}
+	cmd.SysProcAttr.Credential = cred
+	if home != "" {
+		// The last value takes precedence for duplicated variables
+		cmd.Env = append(os.Environ(), "HOME="+home)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCheckProgramCredentials(t *testing.T) {
+	c, err := newCheckFromData(`check process mysql with pidfile /tmp/mysql.pid
+  start program = "/opt/mysql/ctl.sh start" as uid "mysql" and gid "mysql" with timeout 60 seconds
+  stop program = "/opt/mysql/ctl.sh stop" as gid 1001
+  restart program = "/opt/mysql/ctl.sh restart" as uid mysql
+`)
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	assert.Equal(t, "/opt/mysql/ctl.sh start", pc.StartProgram.Cmd)
+	assert.Equal(t, "mysql", pc.StartProgram.UID)
+	assert.Equal(t, "mysql", pc.StartProgram.GID)
+	assert.Equal(t, 60*time.Second, pc.StartProgram.Timeout)
+	assert.Equal(t, "", pc.StopProgram.UID)
+	assert.Equal(t, "1001", pc.StopProgram.GID)
+	assert.Equal(t, "mysql", pc.RestartProgram.UID)
+	assert.Equal(t, "", pc.RestartProgram.GID)
+}
+
+func TestProcessCheckValidateCredentials(t *testing.T) {
+	c, err := newCheckFromData(`check process web with pidfile /tmp/web.pid
+  start program = "/bin/true" as uid "gonit-nonexistent-user"
+`)
+	require.NoError(t, err)
+	cv := newValidator()
+	assert.Error(t, cv.AddCheck(c))
+	assert.False(t, cv.Success)
+
+	c, err = newCheckFromData(`check process web with pidfile /tmp/web.pid
+  stop program = "/bin/true" as uid root and gid "gonit-nonexistent-group"
+`)
+	require.NoError(t, err)
+	assert.Error(t, c.(*ProcessCheck).validate())
+
+	c, err = newCheckFromData(`check process web with pidfile /tmp/web.pid
+  start program = "/bin/true" as uid root and gid 0
+`)
+	require.NoError(t, err)
+	cv = newValidator()
+	assert.NoError(t, cv.AddCheck(c))
+	assert.True(t, cv.Success)
+}
+
+func TestCommandCredentials(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Changing credentials requires running as root")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("User nobody does not exist")
+	}
+	cmd := newCommand(`echo $(id -u) $(id -g) $HOME`, 0, Opts{})
+	cmd.UID = "nobody"
+	out, exitCode, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, fmt.Sprintf("%s %s %s", nobody.Uid, nobody.Gid, nobody.HomeDir), strings.TrimSpace(string(out)))
+
+	cmd.GID = "0"
+	out, _, err = cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s 0 %s", nobody.Uid, nobody.HomeDir), strings.TrimSpace(string(out)))
+
+	cmd.UID = "gonit-nonexistent-user"
+	_, _, err = cmd.Output()
+	assert.EqualError(t, err, "Unknown user 'gonit-nonexistent-user'")
+}
@@ -15,6 +15,29 @@ type ChecksDatabaseEntry struct {
 	Monitored       bool
 	DataCollectedAt time.Time
 	Uptime          time.Duration
+	// Checksum contains the last checksum calculated by a file check
+	Checksum     string
+	ChecksumType string
+	// Pid and PPid contain the last process and parent process ids seen by a
+	// process check
+	Pid  int
+	PPid int
+	// StartAttempts contains, for each of the last cycles, whether a process
+	// check had to start its process
+	StartAttempts []bool
+	// Identity contains the details of the process last seen by a process
+	// check, used to detect pids reused by other processes
+	Identity *processIdentity
+	// Foreground contains the identity of the process spawned by a foreground
+	// process check, adopted if still running when the monitor restarts
+	Foreground *processIdentity
+}
+
+// persistentCheck defines the interface of the checks keeping state
+// across monitor restarts in the database
+type persistentCheck interface {
+	loadState(e *ChecksDatabaseEntry)
+	saveState(e *ChecksDatabaseEntry)
 }
 
 func (e *ChecksDatabaseEntry) rLock() {
@@ -0,0 +1,233 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var dependsRe = regexp.MustCompile(`depends\s+on\s+([^\s,]+(\s*,\s*[^\s,]+)*)`)
+
+// dependentCheck defines the interface of the checks that can depend
+// on other checks
+type dependentCheck interface {
+	dependencies() []string
+	setRestartHandler(func(interface {
+		CheckableProcess
+	}) error)
+}
+
+// parseDependencies reads the check ids listed in a "depends on" statement
+func (c *check) parseDependencies(statement string) {
+	m := dependsRe.FindStringSubmatch(statement)
+	if m == nil {
+		c.logger.Warnf("Ignoring malformed dependencies for %s: %q", c.ID, statement)
+		return
+	}
+	for _, id := range strings.Split(m[1], ",") {
+		c.DependsOn = append(c.DependsOn, strings.TrimSpace(id))
+	}
+}
+
+func (c *check) dependencies() []string {
+	return c.DependsOn
+}
+
+func (c *check) setRestartHandler(handler func(interface {
+	CheckableProcess
+}) error) {
+	c.restartHandler = handler
+}
+
+func checkDependencies(c interface {
+	Checkable
+}) []string {
+	if dc, ok := c.(dependentCheck); ok {
+		return dc.dependencies()
+	}
+	return nil
+}
+
+// sortChecks returns the checks sorted so every check comes after the ones
+// it depends on, otherwise keeping their order. It fails if a check depends
+// on an unknown one or if there are dependency cycles
+func sortChecks(checks []interface {
+	Checkable
+}) ([]interface {
+	Checkable
+}, error) {
+	byID := make(map[string]interface {
+		Checkable
+	}, len(checks))
+	for _, c := range checks {
+		byID[c.GetID()] = c
+	}
+	for _, c := range checks {
+		for _, dep := range checkDependencies(c) {
+			if _, ok := byID[dep]; !ok {
+				return nil, fmt.Errorf("Service %s depends on unknown service %s", c.GetID(), dep)
+			}
+		}
+	}
+	return topologicalSort(checks, byID, checkDependencies)
+}
+
+// sortChecksForStop returns the checks sorted so every check comes before
+// the ones it depends on, otherwise keeping their order
+func sortChecksForStop(checks []interface {
+	Checkable
+}) ([]interface {
+	Checkable
+}, error) {
+	if _, err := sortChecks(checks); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]interface {
+		Checkable
+	}, len(checks))
+	dependents := make(map[string][]string)
+	for _, c := range checks {
+		byID[c.GetID()] = c
+		for _, dep := range checkDependencies(c) {
+			dependents[dep] = append(dependents[dep], c.GetID())
+		}
+	}
+	return topologicalSort(checks, byID, func(c interface {
+		Checkable
+	}) []string {
+		return dependents[c.GetID()]
+	})
+}
+
+// topologicalSort sorts checks so every check comes after the ones returned
+// by edges for it, keeping their order otherwise. It fails if there are cycles
+func topologicalSort(checks []interface {
+	Checkable
+}, byID map[string]interface {
+	Checkable
+}, edges func(interface {
+	Checkable
+}) []string) ([]interface {
+	Checkable
+}, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int, len(checks))
+	sorted := make([]interface {
+		Checkable
+	}, 0, len(checks))
+	var visit func(c interface {
+		Checkable
+	}, path []string) error
+	visit = func(c interface {
+		Checkable
+	}, path []string) error {
+		id := c.GetID()
+		switch state[id] {
+		case visited:
+			return nil
+		case visiting:
+			for i, p := range path {
+				if p == id {
+					path = path[i:]
+					break
+				}
+			}
+			return fmt.Errorf("Dependency cycle detected: %s", strings.Join(append(path, id), " -> "))
+		}
+		state[id] = visiting
+		for _, dep := range edges(c) {
+			if err := visit(byID[dep], append(path, id)); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+		sorted = append(sorted, c)
+		return nil
+	}
+	for _, c := range checks {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// dependentsOf returns the checks directly or indirectly depending on the
+// one with the provided id. sorted must be ordered by dependencies
+func dependentsOf(sorted []interface {
+	Checkable
+}, id string) []interface {
+	Checkable
+} {
+	affected := map[string]bool{id: true}
+	dependents := []interface {
+		Checkable
+	}{}
+	for _, c := range sorted {
+		for _, dep := range checkDependencies(c) {
+			if affected[dep] && !affected[c.GetID()] {
+				affected[c.GetID()] = true
+				dependents = append(dependents, c)
+			}
+		}
+	}
+	return dependents
+}
+
+// runAfterDependencies calls op for every check in its own goroutine, so the
+// ones not related by dependencies are handled concurrently. Every call waits
+// for the calls over the checks it depends on or, if forStop is true, over the
+// checks depending on it. Only dependencies between the provided checks are
+// taken into account. If they form cycles, the checks are not ordered and the
+// error is returned
+func runAfterDependencies(checks []interface {
+	Checkable
+}, forStop bool, op func(interface {
+	Checkable
+})) error {
+	byID := make(map[string]interface {
+		Checkable
+	}, len(checks))
+	for _, c := range checks {
+		byID[c.GetID()] = c
+	}
+	waitFor := make(map[string][]string, len(checks))
+	for _, c := range checks {
+		for _, dep := range checkDependencies(c) {
+			if _, ok := byID[dep]; !ok {
+				continue
+			}
+			if forStop {
+				waitFor[dep] = append(waitFor[dep], c.GetID())
+			} else {
+				waitFor[c.GetID()] = append(waitFor[c.GetID()], dep)
+			}
+		}
+	}
+	_, err := topologicalSort(checks, byID, func(c interface {
+		Checkable
+	}) []string {
+		return waitFor[c.GetID()]
+	})
+	if err != nil {
+		waitFor = nil
+	}
+
+	done := make(map[string]chan struct{}, len(checks))
+	for _, c := range checks {
+		done[c.GetID()] = make(chan struct{})
+	}
+	for _, c := range checks {
+		go func() {
+			defer close(done[c.GetID()])
+			for _, id := range waitFor[c.GetID()] {
+				<-done[id]
+			}
+			op(c)
+		}()
+	}
+	return err
+}
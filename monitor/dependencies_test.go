@@ -0,0 +1,240 @@
+package monitor
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bitnami/gonit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// operationsLog records the order in which services are started and stopped
+type operationsLog struct {
+	sync.Mutex
+	entries []string
+}
+
+func (l *operationsLog) add(entry string) {
+	defer l.Unlock()
+	l.Lock()
+	l.entries = append(l.entries, entry)
+}
+
+type loggedService struct {
+	*dummyService
+	log           *operationsLog
+	startAttempts int
+}
+
+func (s *loggedService) recordStartAttempt() {
+	s.startAttempts++
+}
+
+func (s *loggedService) startsSuspended() bool {
+	return false
+}
+
+func (s *loggedService) Start() error {
+	s.log.add("start " + s.ID)
+	return s.dummyService.Start()
+}
+
+func (s *loggedService) Stop() error {
+	s.log.add("stop " + s.ID)
+	return s.dummyService.Stop()
+}
+
+func (s *loggedService) Restart() error {
+	s.log.add("restart " + s.ID)
+	return s.dummyService.Restart()
+}
+
+func newLoggedService(id string, l *operationsLog, dependencies ...string) *loggedService {
+	s := &loggedService{dummyService: newDummyService(id), log: l}
+	s.DependsOn = dependencies
+	return s
+}
+
+func checkIds(checks []interface {
+	Checkable
+}) string {
+	ids := []string{}
+	for _, c := range checks {
+		ids = append(ids, c.GetID())
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestParseDependencies(t *testing.T) {
+	c, err := newCheckFromData(`check process apache with pidfile /tmp/apache.pid
+  start program = "/bin/true"
+  depends on mysql, memcached
+`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mysql", "memcached"}, c.(*ProcessCheck).DependsOn)
+
+	fc := newTestFileCheck(t, "/etc/hosts", "  depends on apache\n  if does not exist then alert\n")
+	assert.Equal(t, []string{"apache"}, fc.DependsOn)
+	assert.Len(t, fc.rules, 1)
+}
+
+func TestSortChecks(t *testing.T) {
+	l := &operationsLog{}
+	checks := []interface {
+		Checkable
+	}{
+		newLoggedService("apache", l, "mysql", "memcached"),
+		newLoggedService("mysql", l),
+		newLoggedService("wordpress", l, "apache"),
+		newLoggedService("memcached", l),
+		newLoggedService("cron", l),
+	}
+	sorted, err := sortChecks(checks)
+	require.NoError(t, err)
+	assert.Equal(t, "mysql,memcached,apache,wordpress,cron", checkIds(sorted))
+	assert.Equal(t, "apache,wordpress", checkIds(dependentsOf(sorted, "mysql")))
+	assert.Equal(t, "wordpress", checkIds(dependentsOf(sorted, "apache")))
+	assert.Equal(t, "", checkIds(dependentsOf(sorted, "cron")))
+
+	sorted, err = sortChecksForStop(checks)
+	require.NoError(t, err)
+	assert.Equal(t, "wordpress,apache,mysql,memcached,cron", checkIds(sorted))
+
+	checks = append(checks, newLoggedService("php", l, "nginx"))
+	_, err = sortChecks(checks)
+	assert.EqualError(t, err, "Service php depends on unknown service nginx")
+
+	checks[len(checks)-1] = newLoggedService("php", l, "wordpress")
+	checks[1] = newLoggedService("mysql", l, "php")
+	_, err = sortChecks(checks)
+	assert.EqualError(t, err, "Dependency cycle detected: apache -> mysql -> php -> wordpress -> apache")
+}
+
+func TestRunAfterDependencies(t *testing.T) {
+	l := &operationsLog{}
+	checks := []interface {
+		Checkable
+	}{
+		newLoggedService("wordpress", l, "apache"),
+		newLoggedService("apache", l, "mysql"),
+		newLoggedService("mysql", l),
+	}
+	position := func(entry string) int {
+		for i, e := range l.entries {
+			if e == entry {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, forStop := range []bool{false, true} {
+		l.entries = nil
+		wg := sync.WaitGroup{}
+		wg.Add(len(checks))
+		require.NoError(t, runAfterDependencies(checks, forStop, func(c interface {
+			Checkable
+		}) {
+			defer wg.Done()
+			l.add(c.GetID())
+		}))
+		wg.Wait()
+		if forStop {
+			assert.True(t, position("wordpress") < position("apache") && position("apache") < position("mysql"), "Unexpected stop order %v", l.entries)
+		} else {
+			assert.True(t, position("mysql") < position("apache") && position("apache") < position("wordpress"), "Unexpected start order %v", l.entries)
+		}
+	}
+
+	// Cycles are reported, and the checks handled anyway
+	checks[2] = newLoggedService("mysql", l, "wordpress")
+	l.entries = nil
+	wg := sync.WaitGroup{}
+	wg.Add(len(checks))
+	assert.EqualError(t, runAfterDependencies(checks, false, func(c interface {
+		Checkable
+	}) {
+		defer wg.Done()
+		l.add(c.GetID())
+	}), "Dependency cycle detected: wordpress -> apache -> mysql -> wordpress")
+	wg.Wait()
+	assert.Len(t, l.entries, 3)
+}
+
+func TestValidateDependencies(t *testing.T) {
+	cv := newValidator()
+	cv.AddCheck(newLoggedService("a", &operationsLog{}, "b"))
+	cv.AddCheck(newLoggedService("b", &operationsLog{}, "a"))
+	assert.EqualError(t, cv.validateDependencies(), "Dependency cycle detected: a -> b -> a")
+	assert.False(t, cv.Success)
+
+	ctrlFile, _ := sb.WriteFile(sb.TempFile(), []byte(`
+check process a with pidfile /tmp/a.pid
+  depends on b
+check process b with pidfile /tmp/b.pid
+  depends on a
+`), os.FileMode(0600))
+	assert.EqualError(t, ValidateConfigFile(ctrlFile, log.DummyLogger()), "Dependency cycle detected: a -> b -> a")
+	_, err := New(Config{ControlFile: ctrlFile})
+	assert.EqualError(t, err, "Dependency cycle detected: a -> b -> a")
+
+	// Reloading a configuration with cycles is refused too
+	sb.WriteFile(ctrlFile, []byte("check process a with pidfile /tmp/a.pid\n"), os.FileMode(0600))
+	app, err := New(Config{ControlFile: ctrlFile})
+	require.NoError(t, err)
+	assert.NoError(t, ValidateConfigFile(ctrlFile, log.DummyLogger()))
+	sb.WriteFile(ctrlFile, []byte("check process a with pidfile /tmp/a.pid\n  depends on a\n"), os.FileMode(0600))
+	assert.Error(t, app.Reload())
+	assert.NotNil(t, app.FindCheck("a"))
+}
+
+func TestMonitorDependenciesOrder(t *testing.T) {
+	app, err := New(Config{})
+	require.NoError(t, err)
+	l := &operationsLog{}
+	for _, s := range []*loggedService{
+		newLoggedService("apache", l, "mysql"),
+		newLoggedService("mysql", l),
+		newLoggedService("wordpress", l, "apache"),
+		newLoggedService("cron", l),
+	} {
+		require.NoError(t, app.AddCheck(s))
+		s.Initialize(Opts{Logger: log.DummyLogger()})
+	}
+
+	assert.Empty(t, app.StartAll())
+	assert.Equal(t, []string{"start mysql", "start apache", "start wordpress", "start cron"}, l.entries)
+
+	l.entries = nil
+	assert.Empty(t, app.StopAll())
+	assert.Equal(t, []string{"stop wordpress", "stop apache", "stop mysql", "stop cron"}, l.entries)
+
+	// Only the running dependents are restarted
+	assert.Empty(t, app.StartAll())
+	require.NoError(t, app.Stop("wordpress"))
+	l.entries = nil
+	require.NoError(t, app.Restart("mysql"))
+	assert.Equal(t, []string{"stop apache", "restart mysql", "start apache"}, l.entries)
+}
+
+func TestRuleRestartWithDependents(t *testing.T) {
+	app, err := New(Config{})
+	require.NoError(t, err)
+	l := &operationsLog{}
+	apache, mysql := newLoggedService("apache", l, "mysql"), newLoggedService("mysql", l)
+	for _, s := range []*loggedService{apache, mysql} {
+		s.owner = s
+		require.NoError(t, app.AddCheck(s))
+		s.Initialize(Opts{Logger: log.DummyLogger()})
+	}
+	assert.Empty(t, app.StartAll())
+
+	l.entries = nil
+	mysql.runAction(&ruleAction{Name: "restart"})
+	assert.Equal(t, []string{"stop apache", "restart mysql", "start apache"}, l.entries)
+	// Only the restart of mysql is accounted as a start attempt
+	assert.Equal(t, 1, mysql.startAttempts)
+	assert.Equal(t, 0, apache.startAttempts)
+}
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+var entriesCondRe = regexp.MustCompile(`^entries\s+` + operatorPattern + `\s+(\d+)$`)
+
+// DirectoryCheck defines a check monitoring the attributes of a directory
+type DirectoryCheck struct {
+	*pathCheck
+	entries syncInt
+}
+
+func newDirectoryCheck(c *check) *DirectoryCheck {
+	return &DirectoryCheck{pathCheck: newPathCheck(c, "directory", os.FileMode.IsDir)}
+}
+
+// SummaryText returns a string the a short summary of the check status:
+// Directory id       Accessible
+func (c *DirectoryCheck) SummaryText() string {
+	return fmt.Sprintf("Directory %-10s%40s", c.ID, c.getStatusString("Accessible"))
+}
+
+// String returns a string representation for the directory check
+func (c *DirectoryCheck) String() string {
+	s := fmt.Sprintf("Directory '%s'\n", c.ID)
+	if c.IsMonitored() {
+		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString("Accessible"))
+		s += c.statusText()
+		if c.validInfo() != nil {
+			s += fmt.Sprintf("  %-40s %12d\n", "entries", c.entries.Get())
+		}
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
+	} else {
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
+	}
+	return s
+}
+
+// Perform makes the directory check collect the current directory attributes
+// and evaluate all of its conditions
+func (c *DirectoryCheck) Perform() {
+	c.logger.Infof("Performing directory check %s", c.ID)
+	c.refresh()
+	if c.validInfo() != nil {
+		if entries, err := os.ReadDir(c.Path); err != nil {
+			c.logger.Warnf("Error reading directory %s: %s", c.Path, err.Error())
+		} else {
+			c.entries.Set(len(entries))
+		}
+	}
+	c.evaluateRules()
+	c.logger.MDebugf(c.String())
+}
+
+// Parse reads a string containing a monit-like directory configuration text
+// and loads the specified settings
+func (c *DirectoryCheck) Parse(data string) {
+	c.parse(data, c.parseCondition)
+}
+
+func (c *DirectoryCheck) parseCondition(text string) (*condition, error) {
+	if m := entriesCondRe.FindStringSubmatch(text); m != nil {
+		op := m[1]
+		limit, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Text: text, Failure: "Entries failed", test: func() (bool, string) {
+			if c.validInfo() == nil {
+				return false, ""
+			}
+			entries := c.entries.Get()
+			return compare(op, float64(entries), float64(limit)),
+				fmt.Sprintf("entries test failed for %s -- current number of entries is %d", c.Path, entries)
+		}}, nil
+	}
+	return c.pathCheck.parseCondition(text)
+}
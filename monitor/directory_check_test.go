@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDirectoryCheck(t *testing.T, path string, rules string) *DirectoryCheck {
+	return newTestCheck[*DirectoryCheck](t, fmt.Sprintf("check directory spool\n  with path %q\n%s", path, rules))
+}
+
+func TestDirectoryCheckParse(t *testing.T) {
+	dc := newTestDirectoryCheck(t, "/var/spool/sample", `
+  if does not exist then alert
+  if failed permission 0755 then alert
+  if failed uid root then alert
+  if timestamp > 1 hour then alert
+  if entries > 10000 then alert
+`)
+	assert.Equal(t, "/var/spool/sample", dc.Path)
+	require.Len(t, dc.rules, 5)
+	assert.Equal(t, "entries > 10000", dc.rules[4].Condition.String())
+
+	// File specific conditions are not supported
+	dc = newTestDirectoryCheck(t, "/var/spool/sample", "  if size > 10 MB then alert\n")
+	assert.Len(t, dc.rules, 0)
+}
+
+func TestDirectoryCheckConditions(t *testing.T) {
+	dir, _ := sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	os.Chmod(dir, os.FileMode(0755))
+	dc := newTestDirectoryCheck(t, dir, `
+  if does not exist then alert
+  if entries >= 2 then alert
+  if failed permission 0755 then alert
+  if timestamp > 10 minutes then alert
+`)
+	dc.Perform()
+	assert.Equal(t, "Accessible", dc.getStatusString("Accessible"))
+	for _, r := range dc.rules {
+		assert.False(t, r.matched.Get(), "Expected %q to not be matched", r.Condition)
+	}
+
+	for _, f := range []string{"a", "b"} {
+		sb.Touch(filepath.Join(dir, f))
+	}
+	os.Chmod(dir, os.FileMode(0700))
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(dir, old, old)
+	dc.Perform()
+	assert.Equal(t, "Entries failed", dc.getStatusString("Accessible"))
+	assert.Equal(t, 2, dc.entries.Get())
+	assert.False(t, dc.rules[0].matched.Get())
+	for _, r := range dc.rules[1:] {
+		assert.True(t, r.matched.Get(), "Expected %q to be matched", r.Condition)
+	}
+
+	assert.Regexp(t, regexp.MustCompile(`^Directory spool\s+Entries failed$`), dc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(
+		`^Directory 'spool'\n\s+status\s+Entries failed\n\s+path\s+.*\n\s+permission\s+0700\n\s+uid\s+\d+\n\s+gid\s+\d+\n`+
+			`\s+timestamp\s+.*\n\s+entries\s+2\n\s+rule 'does not exist'\s+ok\n\s+rule 'entries >= 2'\s+failed\n`+
+			`\s+rule 'failed permission 0755'\s+failed\n\s+rule 'timestamp > 10 minutes'\s+failed\n\s+monitoring status\s+monitored\n$`,
+	), dc.String())
+
+	os.RemoveAll(dir)
+	dc.Perform()
+	assert.Equal(t, "Does not exist", dc.getStatusString("Accessible"))
+	assert.True(t, dc.rules[0].matched.Get())
+
+	// Regular files are not valid directories
+	dc = newTestDirectoryCheck(t, sb.Touch(sb.TempFile()), "")
+	dc.Perform()
+	assert.Equal(t, "Invalid type", dc.getStatusString("Accessible"))
+}
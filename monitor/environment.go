@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	withEnvironmentRe = regexp.MustCompile(`with\s+environment\s+\{([^}]*)\}`)
+	withWorkdirRe     = regexp.MustCompile(`with\s+workdir\s+(\"[^\"]+\"|[^\s]+)`)
+	withUmaskRe       = regexp.MustCompile(`with\s+umask\s+([^\s]+)`)
+	envVarRe          = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	umaskRe           = regexp.MustCompile(`^0?[0-7]{3}$`)
+	// withSettingsRe matches the settings written as standalone statements,
+	// which apply to all the programs of a process check
+	withSettingsRe = regexp.MustCompile(`with\s+(environment|workdir|umask)\s+[^\n]*`)
+)
+
+// parseEnvironment parses the comma separated list of "NAME=value"
+// variables of a "with environment" option. Values can be quoted
+func parseEnvironment(text string) ([]string, error) {
+	env := []string{}
+	for _, v := range strings.Split(text, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		m := envVarRe.FindStringSubmatch(v)
+		if m == nil {
+			return nil, fmt.Errorf("Invalid environment variable %q", v)
+		}
+		env = append(env, m[1]+"="+unquote(strings.TrimSpace(m[2])))
+	}
+	return env, nil
+}
+
+// parseSettings reads the "with environment", "with workdir" and "with
+// umask" options of a program statement
+func (c *Command) parseSettings(options string) error {
+	if m := withEnvironmentRe.FindStringSubmatch(options); m != nil {
+		env, err := parseEnvironment(m[1])
+		if err != nil {
+			return err
+		}
+		c.Env = env
+	}
+	if m := withWorkdirRe.FindStringSubmatch(options); m != nil {
+		c.Dir = unquote(m[1])
+	}
+	if m := withUmaskRe.FindStringSubmatch(options); m != nil {
+		if !umaskRe.MatchString(m[1]) {
+			return fmt.Errorf("Invalid umask %q", m[1])
+		}
+		c.Umask = m[1]
+	}
+	return nil
+}
+
+// inheritSettings applies the settings configured for all the programs of a
+// process check, unless the program configures its own. Environment
+// variables are combined, with the ones of the program taking precedence
+func (c *Command) inheritSettings(settings *Command) {
+	if c == nil {
+		return
+	}
+	if len(settings.Env) > 0 {
+		c.Env = append(append([]string{}, settings.Env...), c.Env...)
+	}
+	if c.Dir == "" {
+		c.Dir = settings.Dir
+	}
+	if c.Umask == "" {
+		c.Umask = settings.Umask
+	}
+}
+
+// shellScript returns the bash script running script with the command umask
+func (c *Command) shellScript(script string) string {
+	if c.Umask == "" {
+		return script
+	}
+	return fmt.Sprintf("umask %s; %s", c.Umask, script)
+}
+
+// setEnvironment configures cmd to run in the command working directory,
+// with its environment variables added to the ones of the monitor
+func (c *Command) setEnvironment(cmd *exec.Cmd) {
+	cmd.Dir = c.Dir
+	if len(c.Env) == 0 {
+		return
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	// The last value takes precedence for duplicated variables
+	cmd.Env = append(cmd.Env, c.Env...)
+}
+
+// settingsText returns the status lines describing the environment, working
+// directory and umask the command runs with, prefixed by name
+func (c *Command) settingsText(name string) string {
+	if c == nil || c.Cmd == "" {
+		return ""
+	}
+	s := ""
+	if len(c.Env) > 0 {
+		s += fmt.Sprintf("  %-40s %12s\n", name+" environment", strings.Join(c.Env, ", "))
+	}
+	if c.Dir != "" {
+		s += fmt.Sprintf("  %-40s %12s\n", name+" workdir", c.Dir)
+	}
+	if c.Umask != "" {
+		s += fmt.Sprintf("  %-40s %12s\n", name+" umask", c.Umask)
+	}
+	return s
+}
+
+// programsText returns the status lines describing the settings of the
+// process programs
+func (c *ProcessCheck) programsText() string {
+	s := ""
+	for _, p := range []struct {
+		name string
+		cmd  *Command
+	}{
+		{"command", c.ForegroundProgram},
+		{"start program", c.StartProgram},
+		{"stop program", c.StopProgram},
+		{"restart program", c.RestartProgram},
+	} {
+		s += p.cmd.settingsText(p.name)
+	}
+	return s
+}
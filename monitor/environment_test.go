@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvironment(t *testing.T) {
+	env, err := parseEnvironment(` JAVA_HOME=/opt/jdk, ENV=prod,OPTS="-Xmx1g -Xms1g", EMPTY=`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"JAVA_HOME=/opt/jdk", "ENV=prod", "OPTS=-Xmx1g -Xms1g", "EMPTY="}, env)
+
+	_, err = parseEnvironment("JAVA_HOME=/opt/jdk, 1ENV=prod")
+	assert.EqualError(t, err, `Invalid environment variable "1ENV=prod"`)
+}
+
+func TestParseProgramSettings(t *testing.T) {
+	c, err := newCheckFromData(`check process web with pidfile /tmp/web.pid
+  start program = "/opt/app/start" with environment { JAVA_HOME=/opt/jdk, ENV=prod } with workdir /opt/app with umask 027 with timeout 30 seconds
+  stop program = "/opt/app/stop" with umask 7777
+  restart program = "/opt/app/restart" with workdir opt/app
+`)
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	assert.Equal(t, []string{"JAVA_HOME=/opt/jdk", "ENV=prod"}, pc.StartProgram.Env)
+	assert.Equal(t, "/opt/app", pc.StartProgram.Dir)
+	assert.Equal(t, "027", pc.StartProgram.Umask)
+	assert.Equal(t, 30*time.Second, pc.StartProgram.Timeout)
+	// Invalid settings are ignored
+	assert.Equal(t, "", pc.StopProgram.Umask)
+
+	assert.Regexp(t, regexp.MustCompile(`\n\s+start program environment\s+JAVA_HOME=/opt/jdk, ENV=prod\n`+
+		`\s+start program workdir\s+/opt/app\n\s+start program umask\s+027\n\s+restart program workdir\s+opt/app\n`), pc.String())
+	assert.EqualError(t, pc.validate(), "Invalid program for web: working directory must be an absolute path: opt/app")
+}
+
+func TestParseStandaloneProgramSettings(t *testing.T) {
+	c, err := newCheckFromData(`check process web with pidfile /tmp/web.pid
+  start program = "/opt/app/start" with environment { ENV=dev } with umask 077
+  stop program = "/opt/app/stop"
+  with environment { JAVA_HOME=/opt/jdk, ENV=prod }
+  with workdir /opt/app
+  with umask 027
+  with umask 7777
+`)
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	// Standalone settings apply to all the programs, unless they set their own
+	assert.Equal(t, []string{"JAVA_HOME=/opt/jdk", "ENV=prod", "ENV=dev"}, pc.StartProgram.Env)
+	assert.Equal(t, "077", pc.StartProgram.Umask)
+	assert.Equal(t, "/opt/app", pc.StartProgram.Dir)
+	assert.Equal(t, []string{"JAVA_HOME=/opt/jdk", "ENV=prod"}, pc.StopProgram.Env)
+	assert.Equal(t, "/opt/app", pc.StopProgram.Dir)
+	// Invalid settings are ignored
+	assert.Equal(t, "027", pc.StopProgram.Umask)
+	assert.Regexp(t, regexp.MustCompile(`\n\s+stop program environment\s+JAVA_HOME=/opt/jdk, ENV=prod\n`+
+		`\s+stop program workdir\s+/opt/app\n\s+stop program umask\s+027\n`), pc.String())
+}
+
+func TestCommandSettings(t *testing.T) {
+	dir, err := sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	require.NoError(t, err)
+	os.Setenv("GONIT_TEST_VAR", "monitor")
+	defer os.Unsetenv("GONIT_TEST_VAR")
+
+	cmd := newCommand(`echo "$GONIT_TEST_VAR $ENV"; pwd; umask`, 5*time.Second, Opts{})
+	require.NoError(t, cmd.parseSettings("with environment { ENV=prod } with workdir "+dir+" with umask 027"))
+	out, exitCode, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "monitor prod\n"+dir+"\n0027\n", string(out))
+
+	// Without settings, the ones of the monitor are used
+	cwd, _ := os.Getwd()
+	out, _, err = newCommand(`echo "$GONIT_TEST_VAR"; pwd`, 5*time.Second, Opts{}).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "monitor\n"+cwd+"\n", string(out))
+}
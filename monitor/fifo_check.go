@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+)
+
+// FifoCheck defines a check monitoring the attributes of a named pipe
+type FifoCheck struct {
+	*pathCheck
+}
+
+func newFifoCheck(c *check) *FifoCheck {
+	return &FifoCheck{pathCheck: newPathCheck(c, "fifo", func(m os.FileMode) bool {
+		return m&os.ModeNamedPipe != 0
+	})}
+}
+
+// SummaryText returns a string the a short summary of the check status:
+// Fifo id       Accessible
+func (c *FifoCheck) SummaryText() string {
+	return fmt.Sprintf("Fifo %-10s%40s", c.ID, c.getStatusString("Accessible"))
+}
+
+// String returns a string representation for the fifo check
+func (c *FifoCheck) String() string {
+	s := fmt.Sprintf("Fifo '%s'\n", c.ID)
+	if c.IsMonitored() {
+		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString("Accessible"))
+		s += c.statusText()
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
+	} else {
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
+	}
+	return s
+}
+
+// Perform makes the fifo check collect the current fifo attributes
+// and evaluate all of its conditions
+func (c *FifoCheck) Perform() {
+	c.logger.Infof("Performing fifo check %s", c.ID)
+	c.refresh()
+	c.evaluateRules()
+	c.logger.MDebugf(c.String())
+}
+
+// Parse reads a string containing a monit-like fifo configuration text
+// and loads the specified settings
+func (c *FifoCheck) Parse(data string) {
+	c.parse(data, c.pathCheck.parseCondition)
+}
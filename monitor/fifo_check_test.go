@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func newTestFifoCheck(t *testing.T, path string, rules string) *FifoCheck {
+	return newTestCheck[*FifoCheck](t, fmt.Sprintf("check fifo pipe\n  with path %q\n%s", path, rules))
+}
+
+func TestFifoCheckParse(t *testing.T) {
+	fc := newTestFifoCheck(t, "/var/run/logs.fifo", `
+  if does not exist then alert
+  if failed permission 0660 then alert
+  if failed uid root then alert
+  if failed gid root then alert
+  if timestamp > 1 hour then alert
+`)
+	assert.Equal(t, "/var/run/logs.fifo", fc.Path)
+	require.Len(t, fc.rules, 5)
+
+	// File specific conditions are not supported
+	fc = newTestFifoCheck(t, "/var/run/logs.fifo", "  if size > 10 MB then alert\n")
+	assert.Len(t, fc.rules, 0)
+}
+
+func TestFifoCheckConditions(t *testing.T) {
+	fifo := sb.TempFile()
+	require.NoError(t, unix.Mkfifo(fifo, 0660))
+	os.Chmod(fifo, os.FileMode(0660))
+	fc := newTestFifoCheck(t, fifo, `
+  if does not exist then alert
+  if failed permission 0660 then alert
+  if timestamp > 10 minutes then alert
+`)
+	fc.Perform()
+	assert.Equal(t, "Accessible", fc.getStatusString("Accessible"))
+	for _, r := range fc.rules {
+		assert.False(t, r.matched.Get(), "Expected %q to not be matched", r.Condition)
+	}
+	assert.Regexp(t, regexp.MustCompile(`^Fifo pipe\s+Accessible$`), fc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(
+		`^Fifo 'pipe'\n\s+status\s+Accessible\n\s+path\s+.*\n\s+permission\s+0660\n\s+uid\s+\d+\n\s+gid\s+\d+\n`+
+			`\s+timestamp\s+.*\n\s+rule 'does not exist'\s+ok\n\s+rule 'failed permission 0660'\s+ok\n`+
+			`\s+rule 'timestamp > 10 minutes'\s+ok\n\s+monitoring status\s+monitored\n$`,
+	), fc.String())
+
+	os.Chmod(fifo, os.FileMode(0600))
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(fifo, old, old)
+	fc.Perform()
+	assert.Equal(t, "Permission failed", fc.getStatusString("Accessible"))
+	assert.True(t, fc.rules[1].matched.Get())
+	assert.True(t, fc.rules[2].matched.Get())
+
+	os.Remove(fifo)
+	fc.Perform()
+	assert.Equal(t, "Does not exist", fc.getStatusString("Accessible"))
+	assert.True(t, fc.rules[0].matched.Get())
+
+	// A regular file recreated in place of the fifo fails the existence rule
+	sb.Touch(fifo)
+	fc.Perform()
+	assert.Equal(t, "Invalid type", fc.getStatusString("Accessible"))
+	assert.True(t, fc.rules[0].matched.Get())
+	_, msg := fc.rules[0].Condition.Test()
+	assert.Equal(t, fmt.Sprintf("%s is not a fifo", fifo), msg)
+}
@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+)
+
+var (
+	sizeCondRe     = regexp.MustCompile(`^size\s+` + operatorPattern + `\s+([0-9.]+)\s*` + sizeUnitPattern + `?$`)
+	checksumCondRe = regexp.MustCompile(`^changed\s+((md5|sha256)\s+)?checksum$`)
+)
+
+// FileCheck defines a check monitoring the attributes of a regular file
+type FileCheck struct {
+	*pathCheck
+	// ChecksumType configures the hashing algorithm used to calculate the
+	// file checksum (md5 or sha256)
+	ChecksumType string
+	checksum     syncValue
+}
+
+func newFileCheck(c *check) *FileCheck {
+	return &FileCheck{pathCheck: newPathCheck(c, "regular file", os.FileMode.IsRegular)}
+}
+
+// SummaryText returns a string the a short summary of the check status:
+// File id       Accessible
+func (c *FileCheck) SummaryText() string {
+	return fmt.Sprintf("File %-10s%40s", c.ID, c.getStatusString("Accessible"))
+}
+
+// String returns a string representation for the file check
+func (c *FileCheck) String() string {
+	s := fmt.Sprintf("File '%s'\n", c.ID)
+	if c.IsMonitored() {
+		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString("Accessible"))
+		s += c.statusText()
+		if info := c.validInfo(); info != nil {
+			s += fmt.Sprintf("  %-40s %12s\n", "size", formatSize(float64(info.Size())))
+		}
+		if sum := c.getChecksum(); sum != "" {
+			s += fmt.Sprintf("  %-40s %12s\n", fmt.Sprintf("checksum (%s)", c.ChecksumType), sum)
+		}
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
+	} else {
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
+	}
+	return s
+}
+
+// Perform makes the file check collect the current file attributes
+// and evaluate all of its conditions
+func (c *FileCheck) Perform() {
+	c.logger.Infof("Performing file check %s", c.ID)
+	c.refresh()
+	c.evaluateRules()
+	c.logger.MDebugf(c.String())
+}
+
+// Parse reads a string containing a monit-like file configuration text
+// and loads the specified settings
+func (c *FileCheck) Parse(data string) {
+	c.parse(data, c.parseCondition)
+}
+
+func (c *FileCheck) parseCondition(text string) (*condition, error) {
+	switch {
+	case sizeCondRe.MatchString(text):
+		m := sizeCondRe.FindStringSubmatch(text)
+		op := m[1]
+		limit, err := parseSize(m[2], m[3])
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Text: text, Failure: "Size failed", test: func() (bool, string) {
+			info := c.validInfo()
+			if info == nil {
+				return false, ""
+			}
+			size := float64(info.Size())
+			return compare(op, size, limit), fmt.Sprintf("size test failed for %s -- current size is %s", c.Path, formatSize(size))
+		}}, nil
+	case checksumCondRe.MatchString(text):
+		m := checksumCondRe.FindStringSubmatch(text)
+		c.ChecksumType = "md5"
+		if m[2] != "" {
+			c.ChecksumType = m[2]
+		}
+		return &condition{Text: text, Failure: "Checksum changed", test: c.testChecksum}, nil
+	}
+	return c.pathCheck.parseCondition(text)
+}
+
+func (c *FileCheck) getChecksum() string {
+	if sum, ok := c.checksum.Get().(string); ok {
+		return sum
+	}
+	return ""
+}
+
+func (c *FileCheck) testChecksum() (bool, string) {
+	if c.validInfo() == nil {
+		return false, ""
+	}
+	sum, err := c.calculateChecksum()
+	if err != nil {
+		c.logger.Warnf("Error calculating checksum for %s: %s", c.Path, err.Error())
+		return false, ""
+	}
+	previous := c.getChecksum()
+	c.checksum.Set(sum)
+	if previous == "" {
+		return false, ""
+	}
+	return sum != previous, fmt.Sprintf("checksum changed for %s -- current %s checksum is %s", c.Path, c.ChecksumType, sum)
+}
+
+func (c *FileCheck) calculateChecksum() (string, error) {
+	var h hash.Hash
+	switch c.ChecksumType {
+	case "sha256":
+		h = sha256.New()
+	default:
+		h = md5.New()
+	}
+	fh, err := os.Open(c.Path)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	if _, err := io.Copy(h, fh); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *FileCheck) loadState(e *ChecksDatabaseEntry) {
+	if e.ChecksumType == c.ChecksumType {
+		c.checksum.Set(e.Checksum)
+	}
+}
+
+func (c *FileCheck) saveState(e *ChecksDatabaseEntry) {
+	e.Checksum = c.getChecksum()
+	e.ChecksumType = c.ChecksumType
+}
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileCheck(t *testing.T, path string, rules string) *FileCheck {
+	return newTestCheck[*FileCheck](t, fmt.Sprintf("check file sample\n  with path %q\n%s", path, rules))
+}
+
+func TestFileCheckParse(t *testing.T) {
+	fc := newTestFileCheck(t, "/tmp/sample.txt", `
+  if does not exist then alert
+  if size > 100 MB then alert
+  if timestamp > 15 minutes then alert
+  if changed sha256 checksum then alert
+  if failed permission 0640 then alert
+  if failed uid root then alert
+  if failed gid "root" then alert
+`)
+	assert.Equal(t, "/tmp/sample.txt", fc.Path)
+	assert.Equal(t, "sha256", fc.ChecksumType)
+	require.Len(t, fc.rules, 7)
+	for i, text := range []string{
+		"does not exist", "size > 100 MB", "timestamp > 15 minutes",
+		"changed sha256 checksum", "failed permission 0640", "failed uid root", `failed gid "root"`,
+	} {
+		assert.Equal(t, text, fc.rules[i].Condition.String())
+		assert.Equal(t, "alert", fc.rules[i].Action.String())
+	}
+
+	// Unknown conditions and users are ignored
+	fc = newTestFileCheck(t, "/tmp/sample.txt", `
+  if failed uid nonexistentuser1234 then alert
+  if foo > 3 then alert
+`)
+	assert.Len(t, fc.rules, 0)
+}
+
+func TestFileCheckConditions(t *testing.T) {
+	file, _ := sb.WriteFile(sb.TempFile(), []byte("hello"), os.FileMode(0644))
+	os.Chmod(file, os.FileMode(0644))
+	fc := newTestFileCheck(t, file, `
+  if size > 3 B then alert
+  if failed permission 0644 then alert
+  if changed checksum then alert
+  if timestamp > 1 hour then alert
+`)
+	assert.Equal(t, "Initializing", fc.getStatusString("Accessible"))
+	fc.Perform()
+	assert.Equal(t, "Size failed", fc.getStatusString("Accessible"))
+	assert.True(t, fc.rules[0].matched.Get())
+	assert.False(t, fc.rules[1].matched.Get())
+	// The first checksum is taken as the baseline
+	assert.False(t, fc.rules[2].matched.Get())
+	assert.False(t, fc.rules[3].matched.Get())
+
+	sb.WriteFile(file, []byte("bye"), os.FileMode(0600))
+	os.Chmod(file, os.FileMode(0600))
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(file, old, old)
+	fc.Perform()
+	assert.False(t, fc.rules[0].matched.Get())
+	for _, r := range fc.rules[1:] {
+		assert.True(t, r.matched.Get(), "Expected %q to be matched", r.Condition)
+	}
+	assert.Equal(t, "Permission failed", fc.getStatusString("Accessible"))
+
+	// Changes are only reported once
+	fc.Perform()
+	assert.False(t, fc.rules[2].matched.Get())
+
+	os.Remove(file)
+	fc.Perform()
+	assert.Equal(t, "Does not exist", fc.getStatusString("Accessible"))
+	for _, r := range fc.rules {
+		assert.False(t, r.matched.Get(), "Expected %q to not be matched", r.Condition)
+	}
+}
+
+func TestFileCheckDoesNotExist(t *testing.T) {
+	file := sb.TempFile()
+	fc := newTestFileCheck(t, file, "  if does not exist then alert\n")
+	fc.Perform()
+	assert.True(t, fc.rules[0].matched.Get())
+	sb.Touch(file)
+	fc.Perform()
+	assert.False(t, fc.rules[0].matched.Get())
+
+	dir, _ := sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	fc = newTestFileCheck(t, dir, "  if does not exist then alert\n")
+	fc.Perform()
+	assert.Equal(t, "Invalid type", fc.getStatusString("Accessible"))
+	assert.True(t, fc.rules[0].matched.Get())
+}
+
+func TestFileCheckStatusText(t *testing.T) {
+	file, _ := sb.WriteFile(sb.TempFile(), []byte("hello"), os.FileMode(0644))
+	os.Chmod(file, os.FileMode(0644))
+	fc := newTestFileCheck(t, file, "  if changed checksum then alert\n")
+	fc.Perform()
+	assert.Regexp(t, regexp.MustCompile(`^File sample\s+Accessible$`), fc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(
+		`^File 'sample'\n\s+status\s+Accessible\n\s+path\s+.*\n\s+permission\s+0644\n\s+uid\s+\d+\n\s+gid\s+\d+\n`+
+			`\s+timestamp\s+.*\n\s+size\s+5 B\n\s+checksum \(md5\)\s+5d41402abc4b2a76b9719d911017c592\n`+
+			`\s+rule 'changed checksum'\s+ok\n\s+monitoring status\s+monitored\n$`,
+	), fc.String())
+
+	fc.SetMonitored(false)
+	assert.Regexp(t, regexp.MustCompile(`^File sample\s+Not monitored$`), fc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(`^File 'sample'\n\s+monitoring status\s+Not monitored\n$`), fc.String())
+}
+
+func TestFileCheckPersistsChecksum(t *testing.T) {
+	dbFile := sb.TempFile()
+	file, _ := sb.WriteFile(sb.TempFile(), []byte("hello"), os.FileMode(0644))
+	app, err := New(Config{StateFile: dbFile})
+	require.NoError(t, err)
+	fc := newTestFileCheck(t, file, "  if changed checksum then alert\n")
+	require.NoError(t, app.AddCheck(fc))
+	fc.Perform()
+	require.NoError(t, app.UpdateDatabase())
+
+	sb.WriteFile(file, []byte("bye"), os.FileMode(0644))
+
+	// A new monitor instance restores the baseline checksum
+	app, err = New(Config{StateFile: dbFile})
+	require.NoError(t, err)
+	fc = newTestFileCheck(t, file, "  if changed checksum then alert\n")
+	require.NoError(t, app.AddCheck(fc))
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", fc.getChecksum())
+	fc.Perform()
+	assert.True(t, fc.rules[0].matched.Get())
+}
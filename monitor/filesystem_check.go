@@ -0,0 +1,266 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	// mountsFile contains the list of mounted filesystems, used to resolve
+	// the mount point of devices
+	mountsFile    = "/proc/self/mounts"
+	fsUsageCondRe = regexp.MustCompile(`^(space|inode)\s+(usage|free)\s+` + operatorPattern + `\s+([0-9.]+)\s*(%|` + sizeUnitPattern + `)?$`)
+	fsFlagsCondRe = regexp.MustCompile(`^changed\s+fsflags?$`)
+	fsFlagNames   = []struct {
+		flag int64
+		name string
+	}{
+		{unix.ST_NOSUID, "nosuid"},
+		{unix.ST_NODEV, "nodev"},
+		{unix.ST_NOEXEC, "noexec"},
+		{unix.ST_SYNCHRONOUS, "sync"},
+		{unix.ST_NOATIME, "noatime"},
+		{unix.ST_NODIRATIME, "nodiratime"},
+		{unix.ST_RELATIME, "relatime"},
+	}
+)
+
+// filesystemStats contains the usage information of a filesystem
+type filesystemStats struct {
+	SpaceTotal  float64
+	SpaceFree   float64
+	InodesTotal float64
+	InodesFree  float64
+	Flags       int64
+}
+
+// SpaceUsed returns the number of bytes in use
+func (s *filesystemStats) SpaceUsed() float64 {
+	return s.SpaceTotal - s.SpaceFree
+}
+
+// InodesUsed returns the number of inodes in use
+func (s *filesystemStats) InodesUsed() float64 {
+	return s.InodesTotal - s.InodesFree
+}
+
+func percent(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * part / total
+}
+
+// FlagsString returns a mount-like representation of the filesystem flags
+func (s *filesystemStats) FlagsString() string {
+	flags := []string{"rw"}
+	if s.Flags&unix.ST_RDONLY != 0 {
+		flags[0] = "ro"
+	}
+	for _, f := range fsFlagNames {
+		if s.Flags&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	return strings.Join(flags, ",")
+}
+
+// FilesystemCheck defines a check monitoring the space and inode usage of a
+// filesystem, identified by its mount point or device
+type FilesystemCheck struct {
+	*pathCheck
+	stats     syncValue
+	lastFlags syncValue
+}
+
+func newFilesystemCheck(c *check) *FilesystemCheck {
+	return &FilesystemCheck{pathCheck: newPathCheck(c, "mount point or device", func(m os.FileMode) bool {
+		return m.IsDir() || m&os.ModeDevice != 0
+	})}
+}
+
+// findMountPoint returns the mount point of the provided device
+func findMountPoint(device string) (string, error) {
+	fh, err := os.Open(mountsFile)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == device {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("Cannot find mount point for %s", device)
+}
+
+// MountPoint returns the path to the directory in which the filesystem is mounted
+func (c *FilesystemCheck) MountPoint() (string, error) {
+	info := c.validInfo()
+	if info == nil {
+		return "", fmt.Errorf("%s is not a valid %s", c.Path, c.kind)
+	}
+	if info.IsDir() {
+		return c.Path, nil
+	}
+	return findMountPoint(c.Path)
+}
+
+func (c *FilesystemCheck) getStats() *filesystemStats {
+	if stats, ok := c.stats.Get().(*filesystemStats); ok {
+		return stats
+	}
+	return nil
+}
+
+func (c *FilesystemCheck) collectStats() (*filesystemStats, error) {
+	mountPoint, err := c.MountPoint()
+	if err != nil {
+		return nil, err
+	}
+	st := unix.Statfs_t{}
+	if err := unix.Statfs(mountPoint, &st); err != nil {
+		return nil, err
+	}
+	bsize := float64(st.Bsize)
+	return &filesystemStats{
+		SpaceTotal:  float64(st.Blocks) * bsize,
+		SpaceFree:   float64(st.Bavail) * bsize,
+		InodesTotal: float64(st.Files),
+		InodesFree:  float64(st.Ffree),
+		Flags:       int64(st.Flags),
+	}, nil
+}
+
+func (c *FilesystemCheck) getStatusString() string {
+	if c.validInfo() != nil && c.getStats() == nil {
+		return "Data access error"
+	}
+	return c.pathCheck.getStatusString("Accessible")
+}
+
+// SummaryText returns a string the a short summary of the check status:
+// Filesystem id       Accessible
+func (c *FilesystemCheck) SummaryText() string {
+	return fmt.Sprintf("Filesystem %-10s%40s", c.ID, c.getStatusString())
+}
+
+// String returns a string representation for the filesystem check
+func (c *FilesystemCheck) String() string {
+	s := fmt.Sprintf("Filesystem '%s'\n", c.ID)
+	if c.IsMonitored() {
+		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString())
+		s += fmt.Sprintf("  %-40s %12s\n", "path", c.Path)
+		if stats := c.getStats(); stats != nil {
+			s += fmt.Sprintf("  %-40s %12s\n", "flags", stats.FlagsString())
+			s += fmt.Sprintf("  %-40s %12s\n", "space total", formatSize(stats.SpaceTotal))
+			s += fmt.Sprintf("  %-40s %12s\n", "space used",
+				fmt.Sprintf("%s [%.1f%%]", formatSize(stats.SpaceUsed()), percent(stats.SpaceUsed(), stats.SpaceTotal)))
+			s += fmt.Sprintf("  %-40s %12s\n", "space free",
+				fmt.Sprintf("%s [%.1f%%]", formatSize(stats.SpaceFree), percent(stats.SpaceFree, stats.SpaceTotal)))
+			s += fmt.Sprintf("  %-40s %12.0f\n", "inodes total", stats.InodesTotal)
+			s += fmt.Sprintf("  %-40s %12s\n", "inodes used",
+				fmt.Sprintf("%.0f [%.1f%%]", stats.InodesUsed(), percent(stats.InodesUsed(), stats.InodesTotal)))
+			s += fmt.Sprintf("  %-40s %12s\n", "inodes free",
+				fmt.Sprintf("%.0f [%.1f%%]", stats.InodesFree, percent(stats.InodesFree, stats.InodesTotal)))
+		}
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
+	} else {
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
+	}
+	return s
+}
+
+// Perform makes the filesystem check collect the current usage statistics
+// and evaluate all of its conditions
+func (c *FilesystemCheck) Perform() {
+	c.logger.Infof("Performing filesystem check %s", c.ID)
+	c.refresh()
+	if stats, err := c.collectStats(); err != nil {
+		c.logger.Warnf("Error reading filesystem information for %s: %s", c.ID, err.Error())
+		c.stats.Set(nil)
+	} else {
+		c.stats.Set(stats)
+	}
+	c.evaluateRules()
+	c.logger.MDebugf(c.String())
+}
+
+// Parse reads a string containing a monit-like filesystem configuration text
+// and loads the specified settings
+func (c *FilesystemCheck) Parse(data string) {
+	c.parse(data, c.parseCondition)
+}
+
+func (c *FilesystemCheck) parseCondition(text string) (*condition, error) {
+	switch {
+	case fsUsageCondRe.MatchString(text):
+		m := fsUsageCondRe.FindStringSubmatch(text)
+		resource, measure, op, unit := m[1], m[2], m[3], m[5]
+		if resource == "inode" && unit != "%" && unit != "" {
+			return nil, fmt.Errorf("Inode limits must be a number or a percentage")
+		}
+		sizeUnit := unit
+		if unit == "%" {
+			sizeUnit = ""
+		}
+		limit, err := parseSize(m[4], sizeUnit)
+		if err != nil {
+			return nil, err
+		}
+		failure := fmt.Sprintf("%s%s %s failed", strings.ToUpper(resource[0:1]), resource[1:], measure)
+		return &condition{Text: text, Failure: failure, test: func() (bool, string) {
+			stats := c.getStats()
+			if stats == nil {
+				return false, ""
+			}
+			total, value := stats.SpaceTotal, stats.SpaceFree
+			if resource == "inode" {
+				total, value = stats.InodesTotal, stats.InodesFree
+			}
+			if measure == "usage" {
+				value = total - value
+			}
+			current := value
+			if unit == "%" {
+				current = percent(value, total)
+			}
+			return compare(op, current, limit), fmt.Sprintf("%s %s test failed for %s -- current %s %s is %s",
+				resource, measure, c.Path, resource, measure, formatFilesystemValue(resource, value, total))
+		}}, nil
+	case fsFlagsCondRe.MatchString(text):
+		return &condition{Text: text, Failure: "Fsflags changed", test: c.testFlags}, nil
+	}
+	return c.pathCheck.parseCondition(text)
+}
+
+func formatFilesystemValue(resource string, value, total float64) string {
+	if resource == "inode" {
+		return fmt.Sprintf("%.0f [%.1f%%]", value, percent(value, total))
+	}
+	return fmt.Sprintf("%s [%.1f%%]", formatSize(value), percent(value, total))
+}
+
+func (c *FilesystemCheck) testFlags() (bool, string) {
+	stats := c.getStats()
+	if stats == nil {
+		return false, ""
+	}
+	previous, ok := c.lastFlags.Get().(string)
+	current := stats.FlagsString()
+	c.lastFlags.Set(current)
+	if !ok || previous == current {
+		return false, ""
+	}
+	return true, fmt.Sprintf("filesystem flags changed for %s from %s to %s", c.Path, previous, current)
+}
@@ -0,0 +1,89 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func newTestFilesystemCheck(t *testing.T, path string, rules string) *FilesystemCheck {
+	return newTestCheck[*FilesystemCheck](t, fmt.Sprintf("check filesystem data\n  with path %q\n%s", path, rules))
+}
+
+func TestFilesystemCheckParse(t *testing.T) {
+	fc := newTestFilesystemCheck(t, "/", `
+  if space usage > 90% then alert
+  if inode usage > 85% then alert
+  if space free < 2 GB then alert
+  if changed fsflags then alert
+`)
+	require.Len(t, fc.rules, 4)
+	// Inodes cannot be measured in bytes
+	fc = newTestFilesystemCheck(t, "/", "  if inode free < 2 GB then alert\n")
+	assert.Len(t, fc.rules, 0)
+}
+
+func TestFilesystemCheckConditions(t *testing.T) {
+	fc := newTestFilesystemCheck(t, sb.Root, `
+  if space usage >= 0% then alert
+  if inode usage > 100% then alert
+  if space free < 1 TB then alert
+  if space free > 1000000 TB then alert
+  if changed fsflags then alert
+`)
+	fc.Perform()
+	stats := fc.getStats()
+	require.NotNil(t, stats)
+
+	st := unix.Statfs_t{}
+	require.NoError(t, unix.Statfs(sb.Root, &st))
+	assert.Equal(t, float64(st.Blocks)*float64(st.Bsize), stats.SpaceTotal)
+
+	assert.Equal(t, "Space usage failed", fc.getStatusString())
+	for i, expected := range []bool{true, false, stats.SpaceFree < 1024*1024*1024*1024, false, false} {
+		assert.Equal(t, expected, fc.rules[i].matched.Get(), "Unexpected result for %q", fc.rules[i].Condition)
+	}
+
+	// Simulate a remount in read-only mode
+	fc.lastFlags.Set("ro")
+	fc.Perform()
+	assert.True(t, fc.rules[4].matched.Get())
+	fc.Perform()
+	assert.False(t, fc.rules[4].matched.Get())
+
+	assert.Regexp(t, regexp.MustCompile(`^Filesystem data\s+Space usage failed$`), fc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(
+		`^Filesystem 'data'\n\s+status\s+Space usage failed\n\s+path\s+.*\n\s+flags\s+r[ow].*\n`+
+			`\s+space total\s+.*\n\s+space used\s+.*\[[0-9.]+%\]\n\s+space free\s+.*\[[0-9.]+%\]\n`+
+			`\s+inodes total\s+\d+\n\s+inodes used\s+\d+ \[[0-9.]+%\]\n\s+inodes free\s+\d+ \[[0-9.]+%\]\n`+
+			`\s+rule 'space usage >= 0%'\s+failed\n\s+rule 'inode usage > 100%'\s+ok\n\s+rule 'space free < 1 TB'\s+\w+\n`+
+			`\s+rule 'space free > 1000000 TB'\s+ok\n\s+rule 'changed fsflags'\s+ok\n\s+monitoring status\s+monitored\n$`,
+	), fc.String())
+}
+
+func TestFilesystemCheckDevice(t *testing.T) {
+	defer func(f string) { mountsFile = f }(mountsFile)
+	mountsFile, _ = sb.WriteFile(sb.TempFile(), []byte(fmt.Sprintf("/dev/null %s ext4 rw 0 0\n", sb.Root)), os.FileMode(0644))
+
+	fc := newTestFilesystemCheck(t, "/dev/null", "")
+	fc.Perform()
+	mp, err := fc.MountPoint()
+	assert.NoError(t, err)
+	assert.Equal(t, sb.Root, mp)
+	assert.NotNil(t, fc.getStats())
+	assert.Equal(t, "Accessible", fc.getStatusString())
+
+	fc = newTestFilesystemCheck(t, "/dev/zero", "")
+	fc.Perform()
+	assert.Nil(t, fc.getStats())
+	assert.Equal(t, "Data access error", fc.getStatusString())
+
+	fc = newTestFilesystemCheck(t, sb.Touch(sb.TempFile()), "")
+	fc.Perform()
+	assert.Equal(t, "Invalid type", fc.getStatusString())
+}
@@ -0,0 +1,259 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+// minForegroundUptime is the time a foreground process must run for it to
+// be restarted immediately after exiting. Processes exiting sooner are
+// restarted after waiting for it, to avoid spinning on broken services
+const minForegroundUptime = time.Second
+
+// adoptedPollInterval is how often foreground processes adopted after the
+// monitor restarts are checked for having exited
+const adoptedPollInterval = 500 * time.Millisecond
+
+var withCommandRe = regexp.MustCompile(`with\s+command\s+(\"[^\"]+\"|[^\s]+)([^\n]*)`)
+
+// childProcess defines a process spawned by the monitor
+type childProcess struct {
+	pid       int
+	startedAt time.Time
+	// done is closed once the process exits and gets reaped
+	done chan struct{}
+	// owner is the check supervising the process, which changes when the
+	// configuration is reloaded
+	owner syncValue
+}
+
+func (p *childProcess) supervisor() *ProcessCheck {
+	return p.owner.Get().(*ProcessCheck)
+}
+
+func (p *childProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// exitText returns a description of how a process finished, for example
+// "exit code 1" or "signal SIGKILL"
+func exitText(state *os.ProcessState) string {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return fmt.Sprintf("signal %s", signalName(ws.Signal()))
+	}
+	return fmt.Sprintf("exit code %d", state.ExitCode())
+}
+
+// spawn starts the command in its own process group, with the monitor
+// standard output and error, without waiting for it to finish
+func (c *Command) spawn() (*exec.Cmd, error) {
+	c.logger.Debugf("/bin/bash -c exec %s", c.Cmd)
+
+	// exec makes the command replace the shell, so its pid is the one tracked
+	cmd := exec.Command("/bin/bash", "-c", c.shellScript("exec "+c.Cmd))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := c.setCredentials(cmd); err != nil {
+		return nil, err
+	}
+	c.setEnvironment(cmd)
+	return cmd, startChild(cmd)
+}
+
+// isForeground returns true if the process is spawned and supervised by
+// the monitor
+func (c *ProcessCheck) isForeground() bool {
+	return c.ForegroundProgram != nil && c.ForegroundProgram.Cmd != ""
+}
+
+func (c *ProcessCheck) getChild() *childProcess {
+	if p, ok := c.child.Get().(*childProcess); ok {
+		return p
+	}
+	return nil
+}
+
+// foregroundPid returns the pid of the running foreground process or -1
+func (c *ProcessCheck) foregroundPid() int {
+	if p := c.getChild(); p != nil && p.running() {
+		return p.pid
+	}
+	return -1
+}
+
+// spawnForeground starts the foreground program unless it is already running
+func (c *ProcessCheck) spawnForeground() error {
+	defer c.spawnMutex.Unlock()
+	c.spawnMutex.Lock()
+	if p := c.getChild(); p != nil && p.running() {
+		c.logger.Debugf("%s is already running", c.GetID())
+		return nil
+	}
+	cmd, err := c.ForegroundProgram.spawn()
+	if err != nil {
+		c.logger.Warnf("Error starting %s: %s", c.GetID(), err.Error())
+		return err
+	}
+	p := &childProcess{pid: cmd.Process.Pid, startedAt: time.Now(), done: make(chan struct{})}
+	p.owner.Set(c)
+	c.child.Set(p)
+	c.logger.Infof("%s started with pid %d", c.GetID(), p.pid)
+	go c.superviseForeground(cmd, p)
+	return nil
+}
+
+// superviseForeground waits for the foreground process to exit, recording
+// how it finished, and restarts it if it is still supposed to be running
+func (c *ProcessCheck) superviseForeground(cmd *exec.Cmd, p *childProcess) {
+	err := waitChild(cmd)
+	c = p.supervisor()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		c.logger.Warnf("Error waiting for %s: %s", c.GetID(), err.Error())
+	}
+	exit := "unknown status"
+	if cmd.ProcessState != nil {
+		exit = exitText(cmd.ProcessState)
+	}
+	p.exited(exit)
+}
+
+// exited records how the foreground process finished and restarts it if it
+// is still supposed to be running
+func (p *childProcess) exited(exit string) {
+	c := p.supervisor()
+	c.lastExit.Set(exit)
+	c.lastExitAt.Set(time.Now())
+	close(p.done)
+	c.logger.Warnf("%s (pid %d) exited with %s", c.GetID(), p.pid, exit)
+
+	// The monitor starts it again once the start attempts allow it
+	if !c.IsMonitored() || c.isPassive() || c.startsSuspended() {
+		return
+	}
+	if uptime := time.Since(p.startedAt); uptime < minForegroundUptime {
+		time.Sleep(minForegroundUptime - uptime)
+		c = p.supervisor()
+	}
+	// The process was stopped or replaced in the meantime
+	if c.getChild() != p || !c.IsMonitored() {
+		return
+	}
+	c.logger.Infof("Restarting %s", c.GetID())
+	c.recordStartAttempt()
+	c.startedAt.Set(time.Now())
+	c.spawnForeground()
+}
+
+// foregroundIdentity returns the identity of the running foreground process,
+// saved so it can be adopted after the monitor restarts
+func (c *ProcessCheck) foregroundIdentity() *processIdentity {
+	pid := c.foregroundPid()
+	if pid <= 0 {
+		return nil
+	}
+	id, err := readProcessIdentity(pid)
+	if err != nil {
+		return nil
+	}
+	return id
+}
+
+// adoptForeground supervises again the foreground process started by a
+// previous monitor run, which keeps running when the monitor exits, as long
+// as the pid still belongs to it
+func (c *ProcessCheck) adoptForeground(saved *processIdentity) {
+	if saved == nil || c.getChild() != nil {
+		return
+	}
+	id, err := readProcessIdentity(saved.Pid)
+	if err != nil {
+		return
+	}
+	if reason := saved.mismatch(id); reason != "" {
+		c.logger.Debugf("Not adopting %s (pid %d): %s", c.GetID(), saved.Pid, reason)
+		return
+	}
+	startedAt, err := processStartTime(saved.Pid)
+	if err != nil {
+		startedAt = time.Now()
+	}
+	p := &childProcess{pid: saved.Pid, startedAt: startedAt, done: make(chan struct{})}
+	p.owner.Set(c)
+	c.child.Set(p)
+	c.startedAt.Set(startedAt)
+	c.logger.Infof("%s already running with pid %d, supervising it", c.GetID(), p.pid)
+	go p.watch(saved.StartTime)
+}
+
+// watch polls an adopted foreground process until it exits. It is not a
+// child of the monitor, so it cannot be waited for and its exit status is
+// unknown
+func (p *childProcess) watch(startTime uint64) {
+	for {
+		st, err := readProcStat(p.pid)
+		if err != nil || st.State == "Z" || st.StartTime != startTime {
+			break
+		}
+		time.Sleep(adoptedPollInterval)
+	}
+	p.exited("unknown status")
+}
+
+// handOverForeground makes next, the check replacing c after reloading the
+// configuration, supervise the foreground process started by c, which keeps
+// running. Changes to the command apply the next time it is started
+func (c *ProcessCheck) handOverForeground(next *ProcessCheck) {
+	p := c.getChild()
+	if p == nil || !p.running() {
+		return
+	}
+	c.logger.Debugf("Handing %s (pid %d) over to the reloaded check", c.GetID(), p.pid)
+	next.child.Set(p)
+	p.owner.Set(next)
+	c.child.Set(nil)
+}
+
+// releaseForeground stops supervising the foreground process of a check
+// removed after reloading the configuration. If it was not handed over to
+// a new check, the process is stopped
+func (c *ProcessCheck) releaseForeground() {
+	p := c.getChild()
+	if p == nil {
+		return
+	}
+	if !p.running() {
+		// Prevent pending restarts
+		c.child.Set(nil)
+		return
+	}
+	c.logger.Infof("Stopping %s, no longer supervised after reloading", c.GetID())
+	if err := c.Stop(); err != nil {
+		c.logger.Warnf(err.Error())
+	}
+}
+
+// foregroundText returns the status lines describing the foreground
+// program and how it last exited
+func (c *ProcessCheck) foregroundText() string {
+	if !c.isForeground() {
+		return ""
+	}
+	s := fmt.Sprintf("  %-40s %12s\n", "command", c.ForegroundProgram.Cmd)
+	if exit, ok := c.lastExit.Get().(string); ok {
+		s += fmt.Sprintf("  %-40s %12s\n", "last exit", exit)
+		s += fmt.Sprintf("  %-40s %12s\n", "last exit at", c.lastExitAt.Get().Format(time.DateTime))
+	}
+	return s
+}
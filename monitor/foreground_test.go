@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"os"
+	"regexp"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bitnami/gonit/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestForegroundCheck(t *testing.T, data string) *ProcessCheck {
+	pc := newTestCheck[*ProcessCheck](t, data)
+	t.Cleanup(func() {
+		pc.SetMonitored(false)
+		if pid := pc.Pid(); pid > 0 {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	})
+	return pc
+}
+
+func TestParseForegroundCommand(t *testing.T) {
+	pc := newTestForegroundCheck(t, `check process web with command "/usr/bin/web --foreground" as uid root
+  stop signal INT
+`)
+	require.True(t, pc.isForeground())
+	assert.Equal(t, "/usr/bin/web --foreground", pc.ForegroundProgram.Cmd)
+	assert.Equal(t, "root", pc.ForegroundProgram.UID)
+	assert.Equal(t, syscall.SIGINT, pc.StopSignal)
+	assert.Equal(t, "", pc.PidFile)
+	assert.NoError(t, pc.validate())
+	assert.Equal(t, -1, pc.Pid())
+
+	pc = newTestForegroundCheck(t, `check process web with command "/usr/bin/web"
+  with pidfile /tmp/web.pid
+`)
+	assert.EqualError(t, pc.validate(), "Process web cannot use a command along with a pidfile or matching pattern")
+}
+
+func TestProcessCheckForegroundSupervision(t *testing.T) {
+	pc := newTestForegroundCheck(t, `check process web with command "sleep 30"
+  with timeout 2 seconds
+`)
+	require.NoError(t, pc.Start())
+	pid := pc.Pid()
+	require.True(t, pc.IsRunning())
+	assert.Regexp(t, regexp.MustCompile(`\n\s+command\s+sleep 30\n`), pc.String())
+
+	// Exits are detected and the process restarted
+	require.NoError(t, syscall.Kill(pid, syscall.SIGKILL))
+	require.True(t, utils.WaitUntil(func() bool {
+		return pc.IsRunning() && pc.Pid() != pid
+	}, 3*time.Second), "Expected the process to be restarted")
+	assert.Equal(t, "signal SIGKILL", pc.lastExit.Get())
+	assert.Regexp(t, regexp.MustCompile(`\n\s+last exit\s+signal SIGKILL\n\s+last exit at\s+\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\n`), pc.String())
+
+	// Stopped processes are not restarted
+	require.NoError(t, pc.Stop())
+	assert.Equal(t, "signal SIGTERM", pc.lastExit.Get())
+	time.Sleep(1500 * time.Millisecond)
+	assert.False(t, pc.IsRunning())
+}
+
+func TestProcessCheckForegroundExitCode(t *testing.T) {
+	pc := newTestForegroundCheck(t, `check process web with command "sh -c 'sleep 1; exit 3'"
+  with timeout 2 seconds
+`)
+	require.NoError(t, pc.Start())
+	pc.SetMonitored(false)
+	require.True(t, utils.WaitUntil(pc.IsNotRunning, 2*time.Second))
+	assert.Equal(t, "exit code 3", pc.lastExit.Get())
+}
+
+func TestReloadForegroundChecks(t *testing.T) {
+	cfgFile := sb.TempFile()
+	writeConfig := func(data string) {
+		sb.WriteFile(cfgFile, []byte(data), os.FileMode(0600))
+	}
+	writeConfig(`check process web with command "sleep 30"
+  with timeout 2 seconds
+check process worker with command "sleep 40"
+  with timeout 2 seconds
+`)
+	app, err := New(Config{ControlFile: cfgFile, StateFile: sb.TempFile()})
+	require.NoError(t, err)
+	defer app.StopAll()
+	require.Empty(t, app.StartAll())
+	webPid, workerPid := app.FindCheck("web").(*ProcessCheck).Pid(), app.FindCheck("worker").(*ProcessCheck).Pid()
+
+	writeConfig(`check process web with command "sleep 35"
+  with timeout 2 seconds
+`)
+	require.NoError(t, app.Reload())
+	web := app.FindCheck("web").(*ProcessCheck)
+	// The running process is kept, instead of starting a second one
+	assert.Equal(t, webPid, web.Pid())
+	assert.True(t, web.IsRunning())
+	// Services no longer configured are stopped
+	assert.False(t, utils.IsProcessRunning(workerPid))
+
+	// The reloaded check supervises the process
+	require.NoError(t, syscall.Kill(webPid, syscall.SIGKILL))
+	require.True(t, utils.WaitUntil(func() bool {
+		return web.IsRunning() && web.Pid() != webPid
+	}, 3*time.Second), "Expected the process to be restarted")
+	assert.Equal(t, "signal SIGKILL", web.lastExit.Get())
+	// With the new command
+	cmdline, err := readProcCmdline(web.Pid())
+	require.NoError(t, err)
+	assert.Equal(t, "sleep 35", cmdline)
+}
+
+func TestAdoptForegroundProcess(t *testing.T) {
+	cfg := Config{ControlFile: sb.TempFile(), StateFile: sb.TempFile()}
+	sb.WriteFile(cfg.ControlFile, []byte(`check process web with command "sleep 30"
+  with timeout 2 seconds
+`), os.FileMode(0600))
+	app, err := New(cfg)
+	require.NoError(t, err)
+	require.Empty(t, app.StartAll())
+	pid := app.FindCheck("web").(*ProcessCheck).Pid()
+	require.NoError(t, app.UpdateDatabase())
+	// The monitor exits, leaving the process running
+	app.FindCheck("web").SetMonitored(false)
+
+	app, err = New(cfg)
+	require.NoError(t, err)
+	defer app.StopAll()
+	web := app.FindCheck("web").(*ProcessCheck)
+	// The running process is supervised, instead of starting a second one
+	assert.Equal(t, pid, web.Pid())
+	assert.True(t, web.IsRunning())
+	require.NoError(t, syscall.Kill(pid, syscall.SIGKILL))
+	require.True(t, utils.WaitUntil(func() bool {
+		return web.IsRunning() && web.Pid() != pid
+	}, 3*time.Second), "Expected the process to be restarted")
+	assert.Equal(t, "unknown status", web.lastExit.Get())
+
+	// Pids reused by other processes are not adopted
+	require.NoError(t, app.UpdateDatabase())
+	app.database.GetEntry("web").Foreground = &processIdentity{Pid: os.Getpid(), StartTime: 1}
+	require.NoError(t, app.database.Serialize())
+	other, err := New(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, -1, other.FindCheck("web").(*ProcessCheck).Pid())
+}
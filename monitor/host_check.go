@@ -0,0 +1,254 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultPortTestTimeout configures for how long to wait for a port test
+// to connect when no timeout is provided
+const defaultPortTestTimeout = 5 * time.Second
+
+var (
+	portCondRe       = regexp.MustCompile(`^failed\s+(host\s+([^\s]+)\s+)?port\s+(\d+)(.*)$`)
+	unixSocketCondRe = regexp.MustCompile(`^failed\s+unix(socket)?\s+(\"[^\"]+\"|[^\s]+)(.*)$`)
+	portTypeRe       = regexp.MustCompile(`type\s+(tcp|udp)`)
+)
+
+// portTest defines a connection test against a network or unix socket endpoint
+type portTest struct {
+	// Network contains the kind of connection to stablish (tcp, udp, unix or unixgram)
+	Network string
+	// Address contains the endpoint to connect to
+	Address string
+	// Timeout configures for how long to wait for the connection
+	Timeout time.Duration
+	// Protocol contains the name of the application protocol tested
+	// after connecting, if any
+	Protocol     string
+	protocol     protocolTester
+	responseTime syncValue
+	lastError    syncValue
+}
+
+func newPortTest(network, address, options string) (*portTest, error) {
+	if m := portTypeRe.FindStringSubmatch(options); m != nil && m[1] == "udp" {
+		if network == "unix" {
+			network = "unixgram"
+		} else {
+			network = "udp"
+		}
+	}
+	timeout, err := parseWithTimeout(options)
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		timeout = defaultPortTestTimeout
+	}
+	name, tester, err := parseProtocol(options)
+	if err != nil {
+		return nil, err
+	}
+	return &portTest{Network: network, Address: address, Timeout: timeout, Protocol: name, protocol: tester}, nil
+}
+
+// String returns a description of the tested endpoint
+func (pt *portTest) String() string {
+	var s string
+	switch pt.Network {
+	case "unix", "unixgram":
+		s = fmt.Sprintf("unix socket %s", pt.Address)
+	default:
+		_, port, _ := net.SplitHostPort(pt.Address)
+		s = fmt.Sprintf("port %s/%s", port, pt.Network)
+	}
+	if pt.Protocol != "" {
+		s += fmt.Sprintf(" [%s]", strings.ToUpper(pt.Protocol))
+	}
+	return s
+}
+
+// ResponseTime returns the time it took to complete the last test
+func (pt *portTest) ResponseTime() time.Duration {
+	if d, ok := pt.responseTime.Get().(time.Duration); ok {
+		return d
+	}
+	return 0
+}
+
+// Error returns the error found in the last test or nil if it succeeded
+func (pt *portTest) Error() error {
+	if err, ok := pt.lastError.Get().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Run connects to the endpoint, recording the response time and error, if any
+func (pt *portTest) Run() error {
+	start := time.Now()
+	err := pt.run()
+	pt.responseTime.Set(time.Since(start))
+	pt.lastError.Set(err)
+	return err
+}
+
+func (pt *portTest) run() error {
+	conn, err := net.DialTimeout(pt.Network, pt.Address, pt.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if pt.Network == "udp" || pt.Network == "unixgram" {
+		return checkDatagramConn(conn, pt.Timeout)
+	}
+	if pt.protocol != nil {
+		conn.SetDeadline(time.Now().Add(pt.Timeout))
+		return pt.protocol.Test(conn, pt.Address)
+	}
+	return nil
+}
+
+// checkDatagramConn sends an empty datagram and waits for an error reporting
+// the port is unreachable. Not receiving any answer is considered a success
+func checkDatagramConn(conn net.Conn, timeout time.Duration) error {
+	if _, err := conn.Write([]byte{}); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return err
+		}
+	}
+	return nil
+}
+
+// HostCheck defines a check monitoring the network endpoints of a host
+type HostCheck struct {
+	*check
+	// Address contains the hostname or IP of the monitored host
+	Address   string
+	portTests []*portTest
+	checkedAt syncTime
+}
+
+func newHostCheck(c *check) *HostCheck {
+	return &HostCheck{check: c}
+}
+
+func (c *HostCheck) getStatusString() (str string) {
+	switch {
+	case !c.IsMonitored():
+		str = c.getMonitoredString()
+	case c.checkedAt.Get().Equal(time.Time{}):
+		str = "Initializing"
+	case c.failedRule() != nil:
+		str = c.failedRule().Condition.Failure
+	default:
+		str = "Online"
+	}
+	return str
+}
+
+// SummaryText returns a string the a short summary of the check status:
+// Host id       Online
+func (c *HostCheck) SummaryText() string {
+	return fmt.Sprintf("Host %-10s%40s", c.ID, c.getStatusString())
+}
+
+// String returns a string representation for the host check
+func (c *HostCheck) String() string {
+	s := fmt.Sprintf("Host '%s'\n", c.ID)
+	if c.IsMonitored() {
+		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString())
+		if c.Address != "" {
+			s += fmt.Sprintf("  %-40s %12s\n", "address", c.Address)
+		}
+		for _, pt := range c.portTests {
+			result := "-"
+			if err := pt.Error(); err != nil {
+				result = "connection failed"
+			} else if rt := pt.ResponseTime(); rt != 0 {
+				result = fmt.Sprintf("%.3fs", rt.Seconds())
+			}
+			s += fmt.Sprintf("  %-40s %12s\n", fmt.Sprintf("%s response time", pt), result)
+		}
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
+	} else {
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
+	}
+	return s
+}
+
+// Perform makes the host check test all its configured endpoints
+func (c *HostCheck) Perform() {
+	c.logger.Infof("Performing host check %s", c.ID)
+	c.evaluateRules()
+	c.checkedAt.Set(time.Now())
+	c.logger.MDebugf(c.String())
+}
+
+// Parse reads a string containing a monit-like host configuration text
+// and loads the specified settings
+func (c *HostCheck) Parse(data string) {
+	c.parseStatements(data, c.parseCondition, func(kind, value string) bool {
+		if kind != "address" {
+			return false
+		}
+		c.Address = value
+		return true
+	})
+	// Port tests not specifying a host target the check address
+	for _, pt := range c.portTests {
+		if pt.Network == "tcp" || pt.Network == "udp" {
+			if host, port, _ := net.SplitHostPort(pt.Address); host == "" && c.Address != "" {
+				pt.Address = net.JoinHostPort(c.Address, port)
+			}
+		}
+	}
+}
+
+func (c *HostCheck) parseCondition(text string) (*condition, error) {
+	pt, err := parsePortTest(text)
+	if err != nil {
+		return nil, err
+	} else if pt == nil {
+		return nil, fmt.Errorf("Unknown condition %q", text)
+	}
+	c.portTests = append(c.portTests, pt)
+	return newPortCondition(text, pt), nil
+}
+
+// parsePortTest returns the port test described by a "failed port" or
+// "failed unixsocket" condition or nil if text is not a port condition
+func parsePortTest(text string) (*portTest, error) {
+	if m := portCondRe.FindStringSubmatch(text); m != nil {
+		return newPortTest("tcp", net.JoinHostPort(m[2], m[3]), m[4])
+	} else if m := unixSocketCondRe.FindStringSubmatch(text); m != nil {
+		return newPortTest("unix", unquote(m[2]), m[3])
+	}
+	return nil, nil
+}
+
+func newPortCondition(text string, pt *portTest) *condition {
+	return &condition{Text: text, Failure: "Connection failed", test: func() (bool, string) {
+		if err := pt.Run(); err != nil {
+			return true, fmt.Sprintf("failed connecting to %s (%s): %s", pt, pt.Address, err.Error())
+		}
+		return false, ""
+	}}
+}
@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHostCheck(t *testing.T, config string) *HostCheck {
+	return newTestCheck[*HostCheck](t, "check host api "+config)
+}
+
+func listenTCP(t *testing.T) (net.Listener, int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestHostCheckParse(t *testing.T) {
+	hc := newTestHostCheck(t, `with address 127.0.0.1
+  if failed port 8080 type tcp with timeout 2 seconds then alert
+  if failed host 10.0.0.1 port 53 type udp then alert
+  if failed unixsocket /run/php-fpm.sock then alert
+`)
+	assert.Equal(t, "127.0.0.1", hc.Address)
+	require.Len(t, hc.portTests, 3)
+	for i, expected := range []*portTest{
+		{Network: "tcp", Address: "127.0.0.1:8080", Timeout: 2 * time.Second},
+		{Network: "udp", Address: "10.0.0.1:53", Timeout: defaultPortTestTimeout},
+		{Network: "unix", Address: "/run/php-fpm.sock", Timeout: defaultPortTestTimeout},
+	} {
+		pt := hc.portTests[i]
+		assert.Equal(t, expected.Network, pt.Network)
+		assert.Equal(t, expected.Address, pt.Address)
+		assert.Equal(t, expected.Timeout, pt.Timeout)
+	}
+	assert.Equal(t, "port 8080/tcp", hc.portTests[0].String())
+	assert.Equal(t, "unix socket /run/php-fpm.sock", hc.portTests[2].String())
+}
+
+func TestHostCheckPortTests(t *testing.T) {
+	ln, port := listenTCP(t)
+	socket := sb.TempFile()
+	unixLn, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer unixLn.Close()
+
+	hc := newTestHostCheck(t, fmt.Sprintf(`with address 127.0.0.1
+  if failed port %d type tcp with timeout 1 second then alert
+  if failed unixsocket %s with timeout 1 second then alert
+`, port, socket))
+	assert.Equal(t, "Initializing", hc.getStatusString())
+	hc.Perform()
+	assert.Equal(t, "Online", hc.getStatusString())
+	for _, pt := range hc.portTests {
+		assert.NoError(t, pt.Error())
+		assert.True(t, pt.ResponseTime() > 0)
+	}
+	assert.Regexp(t, regexp.MustCompile(`^Host api\s+Online$`), hc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(fmt.Sprintf(
+		`^Host 'api'\n\s+status\s+Online\n\s+address\s+127.0.0.1\n\s+port %d/tcp response time\s+[0-9.]+s\n`+
+			`\s+unix socket %s response time\s+[0-9.]+s\n`+
+			`\s+rule 'failed port %d type tcp with timeout 1 second'\s+ok\n\s+rule 'failed unixsocket %s with timeout 1 second'\s+ok\n`+
+			`\s+monitoring status\s+monitored\n$`, port, regexp.QuoteMeta(socket), port, regexp.QuoteMeta(socket),
+	)), hc.String())
+
+	ln.Close()
+	hc.Perform()
+	assert.Equal(t, "Connection failed", hc.getStatusString())
+	assert.True(t, hc.rules[0].matched.Get())
+	assert.False(t, hc.rules[1].matched.Get())
+	assert.Regexp(t, regexp.MustCompile(fmt.Sprintf(`port %d/tcp response time\s+connection failed\n`, port)), hc.String())
+}
+
+func TestHostCheckUDPPortTest(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	pt, err := newPortTest("tcp", fmt.Sprintf("127.0.0.1:%d", port), "type udp with timeout 200 milliseconds")
+	require.NoError(t, err)
+	assert.Equal(t, "udp", pt.Network)
+	assert.NoError(t, pt.Run())
+
+	// Closed UDP ports are reported as unreachable
+	conn.Close()
+	assert.Error(t, pt.Run())
+}
@@ -0,0 +1,179 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitnami/gonit/utils"
+)
+
+// startTimeTolerance is how much later than its pid file was written a
+// process can be seen starting, as the boot time used to compute the start
+// times only has a precision of seconds
+const startTimeTolerance = time.Second
+
+// processIdentity contains the details identifying a process beyond its
+// pid, which the system reuses for unrelated processes
+type processIdentity struct {
+	Pid int
+	// StartTime contains the time the process started after system boot, in clock ticks
+	StartTime uint64
+	// Exe contains the executable of the process, empty if it cannot be read
+	Exe string
+	// Cmdline contains the command line of the process, empty if it cannot be
+	// read. Changes are reported without considering it a different process,
+	// as many daemons rewrite their process title
+	Cmdline string
+}
+
+// readProcExe returns the path of the executable of a process. Executables
+// replaced or removed after the process started, for example by an upgrade,
+// are reported by their original path
+func readProcExe(pid int) (string, error) {
+	exe, err := os.Readlink(filepath.Join(procDir, strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(exe, " (deleted)"), nil
+}
+
+// readProcessIdentity returns the identity of the process with the
+// provided pid. Only its start time is required, as the executable of
+// processes owned by other users cannot be read
+func readProcessIdentity(pid int) (*processIdentity, error) {
+	st, err := readProcStat(pid)
+	if err != nil {
+		return nil, err
+	}
+	id := &processIdentity{Pid: pid, StartTime: st.StartTime}
+	id.Exe, _ = readProcExe(pid)
+	id.Cmdline, _ = readProcCmdline(pid)
+	return id, nil
+}
+
+// mismatch returns a description of the first difference found between the
+// identities, or an empty string if they belong to the same process. Details
+// unknown in any of them are not compared
+func (id *processIdentity) mismatch(other *processIdentity) string {
+	switch {
+	case id.StartTime != other.StartTime:
+		return "start time changed"
+	case id.Exe != "" && other.Exe != "" && id.Exe != other.Exe:
+		return fmt.Sprintf("executable changed to %s", other.Exe)
+	}
+	return ""
+}
+
+func (c *ProcessCheck) getIdentity() *processIdentity {
+	if id, ok := c.identity.Get().(*processIdentity); ok {
+		return id
+	}
+	return nil
+}
+
+// recordIdentity records the identity of the process running with pid, if
+// it is not the one already recorded. It is called once per cycle so the
+// programs exec'ed by the start scripts are recorded instead of the scripts
+func (c *ProcessCheck) recordIdentity(pid int) {
+	if recorded := c.getIdentity(); recorded != nil && recorded.Pid == pid {
+		return
+	}
+	id, err := readProcessIdentity(pid)
+	if err != nil {
+		c.logger.Debugf("Error reading process information of %s: %s", c.ID, err.Error())
+		return
+	}
+	c.identity.Set(id)
+}
+
+// verifyIdentity returns true if pid belongs to the process recorded for the
+// check, so a stale pid file pointing to an unrelated process reusing its pid
+// is not reported as running. Without a recorded identity, the process
+// must have started before the pid file was written. If Executable is
+// configured, the process must also run it
+func (c *ProcessCheck) verifyIdentity(pid int) bool {
+	current, err := readProcessIdentity(pid)
+	if err != nil {
+		// The process may have just finished
+		c.logger.Debugf("Error reading process information of %s: %s", c.ID, err.Error())
+		return utils.IsProcessRunning(pid)
+	}
+	reason := ""
+	if c.Executable != "" && current.Exe != "" && current.Exe != c.Executable {
+		reason = fmt.Sprintf("runs %s instead of %s", current.Exe, c.Executable)
+	} else if recorded := c.getIdentity(); recorded != nil && recorded.Pid == pid {
+		if reason = recorded.mismatch(current); reason == "" {
+			c.updateCmdline(recorded, current)
+		}
+	} else {
+		reason = c.pidFileMismatch(pid)
+	}
+	c.setStalePid(pid, reason)
+	return reason == ""
+}
+
+// updateCmdline records the command line of the process if it changed since
+// it was recorded, warning about it
+func (c *ProcessCheck) updateCmdline(recorded *processIdentity, current *processIdentity) {
+	if current.Cmdline == "" || current.Cmdline == recorded.Cmdline {
+		return
+	}
+	if recorded.Cmdline != "" {
+		c.logger.Warnf("Command line of %s (pid %d) changed from %q to %q", c.ID, current.Pid, recorded.Cmdline, current.Cmdline)
+	}
+	updated := *recorded
+	updated.Cmdline = current.Cmdline
+	c.identity.Set(&updated)
+}
+
+// pidFileMismatch returns why pid cannot belong to the process that wrote
+// the pid file, for pids without a recorded identity, such as those read
+// the first time the monitor runs. A process started after the pid file was
+// written reused the pid of a process that finished without removing it
+func (c *ProcessCheck) pidFileMismatch(pid int) string {
+	if c.isForeground() || c.matchingRe != nil || c.PidFile == "" {
+		return ""
+	}
+	info, err := os.Stat(c.PidFile)
+	if err != nil {
+		return ""
+	}
+	startedAt, err := processStartTime(pid)
+	if err != nil {
+		return ""
+	}
+	if startedAt.After(info.ModTime().Add(startTimeTolerance)) {
+		return "started after the pid file was written"
+	}
+	return ""
+}
+
+// setStalePid records why pid does not belong to the process of the check,
+// warning about it the first time
+func (c *ProcessCheck) setStalePid(pid int, reason string) {
+	stale := ""
+	if reason != "" {
+		stale = fmt.Sprintf("%d (%s)", pid, reason)
+	}
+	if previous, _ := c.stalePid.Get().(string); stale != "" && stale != previous {
+		c.logger.Warnf("Ignoring process %d for %s, it was reused by another process: %s", pid, c.ID, reason)
+	}
+	c.stalePid.Set(stale)
+}
+
+// identityText returns the status lines describing the configured
+// executable and any stale pid ignored
+func (c *ProcessCheck) identityText() string {
+	s := ""
+	if c.Executable != "" {
+		s += fmt.Sprintf("  %-40s %12s\n", "executable", c.Executable)
+	}
+	if stale, _ := c.stalePid.Get().(string); stale != "" {
+		s += fmt.Sprintf("  %-40s %12s\n", "stale pid", stale)
+	}
+	return s
+}
@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFakeIdentity writes the /proc/<pid> files identifying a process
+func setupFakeIdentity(t *testing.T, pid int, startTime int, exe string, cmdline string) string {
+	dir, _ := sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	pidDir, _ := sb.Mkdir(filepath.Join(dir, strconv.Itoa(pid)), os.FileMode(0755))
+	writeFakeProc(t, pidDir, map[string]string{
+		"stat":    fmt.Sprintf("%d (fake) S 1 %d %d 0 -1 4194560 10 0 0 0 0 0 0 0 20 0 1 0 %d 1000 100 0\n", pid, pid, pid, startTime),
+		"cmdline": cmdline,
+	})
+	require.NoError(t, os.Symlink(exe, filepath.Join(pidDir, "exe")))
+	return dir
+}
+
+func TestReadProcessIdentity(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	procDir = setupFakeIdentity(t, 100, 500, "/usr/sbin/httpd (deleted)", "httpd\x00-k\x00start\x00")
+	id, err := readProcessIdentity(100)
+	require.NoError(t, err)
+	assert.Equal(t, &processIdentity{Pid: 100, StartTime: 500, Exe: "/usr/sbin/httpd", Cmdline: "httpd -k start"}, id)
+
+	for other, expected := range map[processIdentity]string{
+		{Pid: 100, StartTime: 500, Exe: "/usr/sbin/httpd"}: "",
+		{Pid: 100, StartTime: 500}:                         "",
+		{Pid: 100, StartTime: 500, Cmdline: "httpd"}:       "",
+		{Pid: 100, StartTime: 501, Exe: "/usr/sbin/httpd"}: "start time changed",
+		{Pid: 100, StartTime: 500, Exe: "/bin/sh"}:         "executable changed to /bin/sh",
+	} {
+		assert.Equal(t, expected, id.mismatch(&other))
+	}
+}
+
+func TestProcessCheckIdentity(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	pid := os.Getpid()
+	pidFile := sb.TempFile()
+	sb.Write(pidFile, strconv.Itoa(pid))
+	c, err := newCheckFromData(fmt.Sprintf("check process web with pidfile %s\n", pidFile))
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	procDir = setupFakeIdentity(t, pid, 500, "/usr/sbin/httpd", "httpd")
+	pc.Initialize(Opts{})
+	require.True(t, pc.IsRunning())
+	assert.Nil(t, pc.getIdentity())
+	pc.updateProcessIds()
+	assert.Equal(t, uint64(500), pc.getIdentity().StartTime)
+
+	assert.Regexp(t, regexp.MustCompile(`\n\s+command line\s+httpd\n`), pc.String())
+
+	// The identity survives monitor restarts
+	e := &ChecksDatabaseEntry{}
+	pc.saveState(e)
+	pc.identity.Set(nil)
+	pc.loadState(e)
+	assert.Equal(t, "/usr/sbin/httpd", pc.getIdentity().Exe)
+	assert.Equal(t, "httpd", pc.getIdentity().Cmdline)
+
+	// Processes rewriting their title are still the same process, with its
+	// new command line recorded
+	procDir = setupFakeIdentity(t, pid, 500, "/usr/sbin/httpd", "httpd: worker process")
+	assert.True(t, pc.IsRunning())
+	assert.Equal(t, "httpd: worker process", pc.getIdentity().Cmdline)
+
+	// After a reboot, the pid belongs to an unrelated process
+	procDir = setupFakeIdentity(t, pid, 20, "/usr/bin/bash", "bash")
+	assert.False(t, pc.IsRunning())
+	assert.Regexp(t, regexp.MustCompile(fmt.Sprintf(`\n\s+status\s+Stopped\n\s+stale pid\s+%d \(start time changed\)\n`, pid)), pc.String())
+
+	// Until the process is started again, with a new pid
+	sb.Write(pidFile, strconv.Itoa(os.Getppid()))
+	procDir = setupFakeIdentity(t, os.Getppid(), 700, "/usr/sbin/httpd", "httpd")
+	assert.True(t, pc.IsRunning())
+	assert.NotContains(t, pc.String(), "stale pid")
+	pc.updateProcessIds()
+	assert.Equal(t, uint64(700), pc.getIdentity().StartTime)
+}
+
+func TestProcessCheckStalePidFile(t *testing.T) {
+	pidFile := sb.TempFile()
+	pc := newTestStopProcessCheck(t, pidFile, "")
+	pid := startProcessGroup(t, "exec sleep 30", pidFile)
+	require.True(t, pc.IsRunning())
+
+	// Without a recorded identity, processes started after the pid file
+	// was written reused the pid
+	require.NoError(t, os.Chtimes(pidFile, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	assert.False(t, pc.IsRunning())
+	assert.Regexp(t, regexp.MustCompile(fmt.Sprintf(`\n\s+stale pid\s+%d \(started after the pid file was written\)\n`, pid)), pc.String())
+
+	sb.Write(pidFile, strconv.Itoa(pid))
+	assert.True(t, pc.IsRunning())
+}
+
+func TestProcessCheckExecutable(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	pid := os.Getpid()
+	pidFile := sb.TempFile()
+	sb.Write(pidFile, strconv.Itoa(pid))
+	c, err := newCheckFromData(fmt.Sprintf("check process web with pidfile %s\n  with executable /usr/sbin/httpd\n", pidFile))
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	pc.Initialize(Opts{})
+	assert.Equal(t, "/usr/sbin/httpd", pc.Executable)
+	assert.NoError(t, pc.validate())
+
+	procDir = setupFakeIdentity(t, pid, 500, "/usr/bin/python3", "python3")
+	assert.False(t, pc.IsRunning())
+	assert.Regexp(t, regexp.MustCompile(`\n\s+executable\s+/usr/sbin/httpd\n\s+stale pid\s+\d+ \(runs /usr/bin/python3 instead of /usr/sbin/httpd\)\n`), pc.String())
+
+	procDir = setupFakeIdentity(t, pid, 500, "/usr/sbin/httpd", "httpd")
+	assert.True(t, pc.IsRunning())
+
+	pc.Executable = "httpd"
+	assert.EqualError(t, pc.validate(), "Process web executable must be an absolute path: httpd")
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Monitoring modes, configured with a "mode" statement
+const (
+	// ModeActive makes the monitor start services that are down and run the
+	// start, stop and restart rule actions. This is the default
+	ModeActive = "active"
+	// ModePassive makes the monitor only report problems, never starting,
+	// stopping or restarting the service by itself
+	ModePassive = "passive"
+	// ModeManual makes the monitor watch the service only while it was
+	// started through gonit
+	ModeManual = "manual"
+)
+
+var modeRe = regexp.MustCompile(`mode\s+(active|passive|manual)`)
+
+// parseMode configures the check monitoring mode from a "mode" statement
+func (c *check) parseMode(statement string) {
+	m := modeRe.FindStringSubmatch(statement)
+	if m == nil {
+		c.logger.Warnf("Ignoring malformed mode for %s: %q", c.ID, statement)
+		return
+	}
+	c.Mode = m[1]
+}
+
+// getMode returns the check monitoring mode
+func (c *check) getMode() string {
+	if c.Mode == "" {
+		return ModeActive
+	}
+	return c.Mode
+}
+
+// isPassive returns true if the monitor must not start, stop or restart the
+// service by itself
+func (c *check) isPassive() bool {
+	return c.getMode() == ModePassive
+}
+
+// modeText returns the status line describing the check monitoring mode,
+// only if it was configured
+func (c *check) modeText() string {
+	if c.Mode == "" {
+		return ""
+	}
+	return fmt.Sprintf("  %-40s %12s\n", "monitoring mode", c.Mode)
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bitnami/gonit/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestModeProcessCheck(t *testing.T, mode string, startedFile string) *ProcessCheck {
+	return newTestCheck[*ProcessCheck](t, fmt.Sprintf(`check process web with pidfile %s
+  start program = "touch %s"
+  mode %s
+  if changed pid then restart
+`, sb.TempFile(), startedFile, mode))
+}
+
+func TestParseMode(t *testing.T) {
+	startedFile := sb.TempFile()
+	pc := newTestModeProcessCheck(t, "passive", startedFile)
+	assert.Equal(t, ModePassive, pc.Mode)
+	assert.Equal(t, "touch "+startedFile, pc.StartProgram.Cmd)
+	assert.Len(t, pc.rules, 1)
+	assert.Regexp(t, regexp.MustCompile(`\n\s+monitoring mode\s+passive\n\s+monitoring status`), pc.String())
+
+	fc := newTestFileCheck(t, "/etc/hosts", "  mode manual\n  if does not exist then alert\n")
+	assert.Equal(t, ModeManual, fc.Mode)
+	assert.Len(t, fc.rules, 1)
+
+	fc = newTestFileCheck(t, "/etc/hosts", "  if does not exist then alert\n")
+	assert.Equal(t, ModeActive, fc.getMode())
+	assert.NotContains(t, fc.String(), "monitoring mode")
+}
+
+func TestProcessCheckPassiveMode(t *testing.T) {
+	startedFile := sb.TempFile()
+	pc := newTestModeProcessCheck(t, "passive", startedFile)
+	require.True(t, pc.IsMonitored())
+	pc.Perform()
+	assert.False(t, utils.FileExists(startedFile), "Passive services must not be started")
+
+	pc.runAction(&ruleAction{Name: "restart"})
+	assert.False(t, utils.FileExists(startedFile), "Passive services must not be restarted")
+
+	pc = newTestModeProcessCheck(t, "active", startedFile)
+	pc.StartProgram.Timeout = 0
+	pc.Perform()
+	assert.True(t, utils.WaitUntil(func() bool {
+		return utils.FileExists(startedFile)
+	}, 2*time.Second), "Active services must be started")
+}
+
+func TestProcessCheckManualMode(t *testing.T) {
+	startedFile := sb.TempFile()
+	pc := newTestModeProcessCheck(t, "manual", startedFile)
+	assert.False(t, pc.IsMonitored(), "Manual services must not be monitored until started")
+	assert.Regexp(t, regexp.MustCompile(`\n\s+monitoring mode\s+manual\n\s+monitoring status\s+Not monitored\n$`), pc.String())
+	pc.Perform()
+	assert.False(t, utils.FileExists(startedFile))
+
+	pc.start()
+	assert.True(t, pc.IsMonitored())
+	assert.True(t, utils.FileExists(startedFile))
+	pc.stop()
+	assert.False(t, pc.IsMonitored())
+}
@@ -2,9 +2,11 @@
 package monitor
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
@@ -12,6 +14,9 @@ import (
 	"github.com/bitnami/gonit/utils"
 )
 
+// ErrShutdownTimeout is returned by Shutdown when the services do not stop in time
+var ErrShutdownTimeout = errors.New("Timed out stopping services")
+
 // Logger defines the required interface to support to be able to log
 // messages
 type Logger interface {
@@ -78,6 +83,12 @@ type Monitor struct {
 	SocketFile string
 
 	lastCheck syncTime
+	// onReboot contains the global policy applied to the checks by the
+	// first daemon run after a reboot, OnRebootLastState if empty
+	onReboot string
+	// shuttingDown stops the checks from being performed while Shutdown
+	// stops the services
+	shuttingDown syncBool
 
 	// Checks contains the list of registered system checks
 	checks []interface {
@@ -125,6 +136,7 @@ func New(c Config) (*Monitor, error) {
 		logger:        logger,
 		database:      db,
 	}
+	mon.shuttingDown.Set(false)
 
 	// Do we need this? Should it be calle uptime or start time?
 	// if db != nil {
@@ -133,6 +145,9 @@ func New(c Config) (*Monitor, error) {
 
 	if c.ControlFile != "" {
 		utils.EnsureSafePermissions(c.ControlFile)
+		if err := ValidateConfigFile(c.ControlFile, logger); err != nil {
+			return mon, err
+		}
 		loader := &configLoader{app: mon, Logger: logger}
 
 		if err := new(configParser).ParseConfigFile(c.ControlFile, loader, logger); err != nil {
@@ -166,6 +181,16 @@ func (m *Monitor) Uptime() time.Duration {
 
 // UpdateDatabase updates the file database with the in-memory state
 func (m *Monitor) UpdateDatabase() error {
+	// Shutdown persists the status the checks had before stopping them
+	if m.shuttingDown.Get() {
+		return nil
+	}
+	return m.updateDatabase(nil)
+}
+
+// updateDatabase persists the checks state, taking the monitored status from
+// the monitored map for the checks included in it
+func (m *Monitor) updateDatabase(monitored map[string]bool) error {
 	whileList := make(map[string]struct{}, 0)
 	for _, c := range m.checks {
 		e := m.database.GetEntry(c.GetID())
@@ -174,7 +199,14 @@ func (m *Monitor) UpdateDatabase() error {
 		}
 		defer e.unlock()
 		e.lock()
-		e.Monitored = c.IsMonitored()
+		if v, ok := monitored[c.GetID()]; ok {
+			e.Monitored = v
+		} else {
+			e.Monitored = c.IsMonitored()
+		}
+		if pc, ok := c.(persistentCheck); ok {
+			pc.saveState(e)
+		}
 		whileList[c.GetID()] = struct{}{}
 	}
 	// TODO: Maybe we should just leave old entries alone or
@@ -225,6 +257,17 @@ func (m *Monitor) FindCheck(id string) interface {
 // the same id
 func (m *Monitor) AddCheck(c interface {
 	Checkable
+}) error {
+	return m.addCheck(c, nil)
+}
+
+// addCheck registers c, which takes over the supervision of the foreground
+// process of the check with its same id in previous, if any. That way,
+// reloading the configuration neither restarts nor duplicates them
+func (m *Monitor) addCheck(c interface {
+	Checkable
+}, previous []interface {
+	Checkable
 }) error {
 	if m.FindCheck(c.GetID()) != nil {
 		return fmt.Errorf("Error: Service name conflict, %s already defined", c.GetID())
@@ -234,6 +277,10 @@ func (m *Monitor) AddCheck(c interface {
 	c.Initialize(Opts{
 		Logger: m.logger,
 	})
+	// Restarts triggered by rules also restart the dependent checks
+	if dc, ok := c.(dependentCheck); ok {
+		dc.setRestartHandler(m.restartWithDependents)
+	}
 
 	e := m.database.GetEntry(c.GetID())
 	if e == nil {
@@ -245,6 +292,17 @@ func (m *Monitor) AddCheck(c interface {
 		defer e.rUnlock()
 		e.rLock()
 		c.SetMonitored(e.Monitored)
+		if pc, ok := c.(persistentCheck); ok {
+			pc.loadState(e)
+		}
+	}
+	if pc, ok := c.(*ProcessCheck); ok && pc.isForeground() {
+		for _, p := range previous {
+			if ppc, ok := p.(*ProcessCheck); ok && p.GetID() == c.GetID() {
+				ppc.handOverForeground(pc)
+			}
+		}
+		pc.adoptForeground(e.Foreground)
 	}
 	m.checks = append(m.checks, c)
 	return nil
@@ -256,15 +314,20 @@ func (m *Monitor) Reload() error {
 	m.logger.Printf("Reloading")
 	validator := newValidator()
 	validator.Logger = m.logger
-	new(configParser).ParseConfigFile(m.ControlFile, validator, m.logger)
-	if validator.Success {
+	if err := validator.validate(m.ControlFile); err == nil {
 		m.logger.Printf("Configuration validates, loading it....")
+		previous := m.checks
 		m.checks = nil
 		for _, c := range validator.Checks {
-			if err := m.AddCheck(c); err != nil {
+			if err := m.addCheck(c, previous); err != nil {
 				m.logger.Warnf(err.Error())
 			}
 		}
+		for _, c := range previous {
+			if pc, ok := c.(*ProcessCheck); ok && pc.isForeground() {
+				pc.releaseForeground()
+			}
+		}
 	} else {
 		m.logger.Warnf("Refusing to reload incorrect configuration")
 		return fmt.Errorf("Refusing to reload incorrect configuration")
@@ -289,6 +352,7 @@ func (m *Monitor) RuntimeDebugStats() string {
 
 // LoopForever allows performing all registerd checks in a loop
 func (m *Monitor) LoopForever(finish chan bool) {
+	m.handleReboot()
 	for {
 		select {
 		case <-finish:
@@ -311,15 +375,29 @@ func (m *Monitor) LoopForever(finish chan bool) {
 // Perform calls the Perform method for all managed checks currently
 // monitored
 func (m *Monitor) Perform() {
+	if m.shuttingDown.Get() {
+		m.logger.Debugf("Skipping checks while shutting down")
+		return
+	}
 	m.logger.Infof("Performing checks")
 
-	m.lastCheck.Set(time.Now())
+	now := time.Now()
+	m.lastCheck.Set(now)
 	for _, c := range m.checks {
-		if c.IsMonitored() {
-			// The slow part of CheckOnce is already in a goroutine
-			// but we don't need to wait for the rest either
-			go CheckOnce(c, Opts{Logger: m.logger})
+		if !c.IsMonitored() {
+			continue
+		}
+		if sc, ok := c.(scheduledCheck); ok {
+			due := sc.isDue(now)
+			sc.updateNextCheck(now, m.CheckInterval)
+			if !due {
+				m.logger.Debugf("Skipping check %s, not scheduled for this cycle", c.GetID())
+				continue
+			}
 		}
+		// The slow part of CheckOnce is already in a goroutine
+		// but we don't need to wait for the rest either
+		go CheckOnce(c, Opts{Logger: m.logger})
 	}
 }
 
@@ -346,11 +424,38 @@ func (m *Monitor) StartServer() error {
 	return nil
 }
 
-func (m *Monitor) doMultiProcessOperation(cb func(interface {
+// sortedChecks returns the registered checks sorted by their dependencies
+func (m *Monitor) sortedChecks() []interface {
+	Checkable
+} {
+	sorted, err := sortChecks(m.checks)
+	if err != nil {
+		m.logger.Warnf("Cannot sort services by their dependencies: %s", err.Error())
+		return m.checks
+	}
+	return sorted
+}
+
+// sortedChecksForStop returns the registered checks sorted so the ones
+// depending on others come first
+func (m *Monitor) sortedChecksForStop() []interface {
+	Checkable
+} {
+	sorted, err := sortChecksForStop(m.checks)
+	if err != nil {
+		m.logger.Warnf("Cannot sort services by their dependencies: %s", err.Error())
+		return m.checks
+	}
+	return sorted
+}
+
+func (m *Monitor) doMultiProcessOperation(checks []interface {
+	Checkable
+}, cb func(interface {
 	CheckableProcess
 }) error) []error {
 	res := []error{}
-	for _, check := range m.checks {
+	for _, check := range checks {
 		if pc, ok := check.(interface {
 			CheckableProcess
 		}); ok {
@@ -429,9 +534,50 @@ func (m *Monitor) Stop(id string) error {
 	return m.findAndExecProcessCheck(id, stopProcess)
 }
 
-// Restart allows restarting a process check by ID
+// StopReport describes the escalation steps taken by the last stop of the
+// process check with the given ID, if any
+func (m *Monitor) StopReport(id string) string {
+	if pc, ok := m.FindCheck(id).(*ProcessCheck); ok {
+		return pc.stopReport()
+	}
+	return ""
+}
+
+// Restart allows restarting a process check by ID. The running process
+// checks depending on it are restarted too
 func (m *Monitor) Restart(id string) error {
-	return m.findAndExecProcessCheck(id, restartProcess)
+	return m.findAndExecProcessCheck(id, m.restartWithDependents)
+}
+
+// restartWithDependents restarts a process check along with the running
+// process checks depending on it, which are stopped before and started after it
+func (m *Monitor) restartWithDependents(pc interface {
+	CheckableProcess
+}) error {
+	dependents := []interface {
+		CheckableProcess
+	}{}
+	for _, c := range dependentsOf(m.sortedChecks(), pc.GetID()) {
+		if dc, ok := c.(interface {
+			CheckableProcess
+		}); ok && dc.IsRunning() {
+			dependents = append(dependents, dc)
+		}
+	}
+	for i := len(dependents) - 1; i >= 0; i-- {
+		m.logger.Infof("Stopping %s, which depends on %s", dependents[i].GetID(), pc.GetID())
+		if err := stopProcess(dependents[i]); err != nil {
+			m.logger.Warnf(err.Error())
+		}
+	}
+	err := restartProcess(pc)
+	for _, dc := range dependents {
+		m.logger.Infof("Starting %s, which depends on %s", dc.GetID(), pc.GetID())
+		if err := startProcess(dc); err != nil {
+			m.logger.Warnf(err.Error())
+		}
+	}
+	return err
 }
 
 // MonitorAll set all checks monitored status to true
@@ -454,19 +600,19 @@ func (m *Monitor) UnmonitorAll() (errors []error) {
 	return errors
 }
 
-// StartAll allows starting all process checks
+// StartAll allows starting all process checks, after the ones they depend on
 func (m *Monitor) StartAll() []error {
-	return m.doMultiProcessOperation(startProcess)
+	return m.doMultiProcessOperation(m.sortedChecks(), startProcess)
 }
 
-// StopAll allows stopping all process checks
+// StopAll allows stopping all process checks, before the ones they depend on
 func (m *Monitor) StopAll() []error {
-	return m.doMultiProcessOperation(stopProcess)
+	return m.doMultiProcessOperation(m.sortedChecksForStop(), stopProcess)
 }
 
-// RestartAll allows restarting all process checks
+// RestartAll allows restarting all process checks, after the ones they depend on
 func (m *Monitor) RestartAll() []error {
-	return m.doMultiProcessOperation(restartProcess)
+	return m.doMultiProcessOperation(m.sortedChecks(), restartProcess)
 }
 
 // SummaryText returns a string containing a short status summary for every
@@ -511,6 +657,86 @@ func (m *Monitor) StatusText(args ...string) string {
 	return s
 }
 
+// SignalAll sends sig to the running processes of all process checks
+func (m *Monitor) SignalAll(sig syscall.Signal) []error {
+	return m.doMultiProcessOperation(m.checks, func(p interface {
+		CheckableProcess
+	}) error {
+		pid := p.Pid()
+		if pid <= 0 || !p.IsRunning() {
+			return nil
+		}
+		m.logger.Infof("Sending %s to %s (%d)", signalName(sig), p.GetID(), pid)
+		if err := syscall.Kill(pid, sig); err != nil {
+			return fmt.Errorf("Error sending %s to %s: %s", signalName(sig), p.GetID(), err.Error())
+		}
+		return nil
+	})
+}
+
+// killAll sends SIGKILL to the process groups of the running processes of
+// all process checks, so their children do not survive them
+func (m *Monitor) killAll() []error {
+	return m.doMultiProcessOperation(m.checks, func(p interface {
+		CheckableProcess
+	}) error {
+		pid := p.Pid()
+		if pid <= 0 || !p.IsRunning() {
+			return nil
+		}
+		target, targetText := signalTarget(pid)
+		m.logger.Warnf("Sending SIGKILL to %s (%s)", targetText, p.GetID())
+		if err := syscall.Kill(target, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("Error sending SIGKILL to %s: %s", p.GetID(), err.Error())
+		}
+		return nil
+	})
+}
+
+// Shutdown stops all process checks, before the ones they depend on, waiting
+// for them up to timeout. Processes still running by then are killed along
+// with their process groups and
+// ErrShutdownTimeout returned. The checks keep their monitored status in the
+// database, so they are started again the next time the monitor runs, while
+// in memory they are all unmonitored
+func (m *Monitor) Shutdown(timeout time.Duration) error {
+	m.logger.Infof("Shutting down, stopping all services")
+	m.shuttingDown.Set(true)
+	monitored := make(map[string]bool, len(m.checks))
+	for _, c := range m.checks {
+		monitored[c.GetID()] = c.IsMonitored()
+		// Prevent the services not stopped yet, or killed on timeout, from
+		// being restarted
+		c.SetMonitored(false)
+	}
+	defer func() {
+		if err := m.updateDatabase(monitored); err != nil {
+			m.logger.Warnf("Error updating database: %s", err.Error())
+		}
+	}()
+
+	done := make(chan []error, 1)
+	go func() {
+		done <- m.StopAll()
+	}()
+	select {
+	case errs := <-done:
+		if len(errs) > 0 {
+			msgs := []string{}
+			for _, err := range errs {
+				msgs = append(msgs, err.Error())
+			}
+			return fmt.Errorf("Error stopping services:\n%s", strings.Join(msgs, "\n"))
+		}
+		m.logger.Infof("All services stopped")
+		return nil
+	case <-time.After(timeout):
+		m.logger.Warnf("Timed out after %v stopping services, killing the remaining ones", timeout)
+		m.killAll()
+		return ErrShutdownTimeout
+	}
+}
+
 // Terminate allows cleaning quitting a monitor (ie. stopping the HTTP server)
 func (m *Monitor) Terminate() (err error) {
 	m.logger.Info("Terminating application...")
@@ -287,7 +287,7 @@ func TestLoopForeverStopsCheckingMultipleErrors(t *testing.T) {
 	ch2 := v2.(*ProcessCheck)
 	assert.False(t, ch1.IsRunning())
 	assert.False(t, ch2.IsRunning())
-	ch1.maxStartTries = 1
+	ch1.maxStartTries, ch1.startTriesCycles = 2, 3
 	app.CheckInterval = 100 * time.Millisecond
 	stopCh := make(chan bool)
 	go app.LoopForever(stopCh)
@@ -295,14 +295,15 @@ func TestLoopForeverStopsCheckingMultipleErrors(t *testing.T) {
 	assert.True(t, ch1.IsRunning())
 	assert.True(t, ch2.IsRunning())
 
-	assert.Equal(t, ch1.startTriesCnt.Get(), 0)
-	assert.Equal(t, ch2.startTriesCnt.Get(), 0)
+	// The initial start attempt is already out of the window of cycles
+	assert.Equal(t, 0, ch1.startTries())
+	assert.True(t, ch2.IsMonitored())
 
 	doErrorFile := filepath.Join(rootDir, fmt.Sprintf("%s.doerror", id1))
 	sb.Touch(doErrorFile)
 	sb.Touch(filepath.Join(rootDir, fmt.Sprintf("%s.stop", id1)))
 
-	time.Sleep(3 * time.Second)
+	time.Sleep(5 * time.Second)
 	assert.True(t, ch2.IsRunning())
 	assert.False(t, ch1.IsRunning())
 	assert.False(t, ch1.IsMonitored())
@@ -651,7 +652,7 @@ func TestStatusText(t *testing.T) {
 
 	app.AddCheck(dc1)
 	app.AddCheck(dc2)
-	dummy1Pattern := `\s*Process\s+'dummy1'\s*\n\s*status\s+Running\n\s*pid\s*\d+\n\s*uptime\s*\d+s?\n\s*monitoring status\s*monitored\n\s*`
+	dummy1Pattern := `\s*Process\s+'dummy1'\s*\n\s*status\s+Running\n\s*pid\s*\d+\n\s*parent pid\s*\d+\n\s*uptime\s*\d+s?\n\s*monitoring status\s*monitored\n\s*`
 	dummy2Pattern := `\s*Process\s+'dummy2'\s*\n\s*status\s+Stopped\n\s*uptime\s*0s?\n\s*monitoring status\s*monitored\n\s*`
 	assert.Regexp(t, regexp.MustCompile(
 		statusTextHeaderPattern+dummy1Pattern+`\n`+dummy2Pattern+`$`,
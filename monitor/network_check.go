@@ -0,0 +1,339 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// sysClassNetDir contains the sysfs directory describing the network interfaces
+	sysClassNetDir    = "/sys/class/net"
+	linkDownCondRe    = regexp.MustCompile(`^link\s+down$`)
+	linkChangedCondRe = regexp.MustCompile(`^changed\s+link(\s+capacity)?$`)
+	saturationCondRe  = regexp.MustCompile(`^saturation\s+` + operatorPattern + `\s+([0-9.]+)\s*%$`)
+	transferCondRe    = regexp.MustCompile(`^(upload|download)\s+` + operatorPattern + `\s+([0-9.]+)\s*(packets?|` + sizeUnitPattern + `)\s*/\s*s$`)
+)
+
+// interfaceCounters contains the cumulative traffic counters of a network interface
+type interfaceCounters struct {
+	RxBytes   float64
+	RxPackets float64
+	TxBytes   float64
+	TxPackets float64
+	ReadAt    time.Time
+}
+
+// networkStats contains the state of a network interface
+type networkStats struct {
+	Link bool
+	// Unavailable is true if the interface could not be found or read, in
+	// which case its link is reported down and its counters are the ones
+	// last read
+	Unavailable bool
+	// Speed contains the link speed in Mb/s or -1 if unknown
+	Speed int
+	interfaceCounters
+	// Rates contain the bytes and packets transferred per second since the
+	// previous cycle, or -1 if unknown
+	RxBytesRate   float64
+	RxPacketsRate float64
+	TxBytesRate   float64
+	TxPacketsRate float64
+}
+
+// LinkString returns a description of the link state
+func (s *networkStats) LinkString() string {
+	if s.Link {
+		return "up"
+	}
+	return "down"
+}
+
+// SpeedString returns a description of the link speed
+func (s *networkStats) SpeedString() string {
+	if s.Speed < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d Mb/s", s.Speed)
+}
+
+// Saturation returns the percentage of the link capacity in use by the
+// busiest direction or -1 if unknown
+func (s *networkStats) Saturation() float64 {
+	if s.Speed <= 0 || s.RxBytesRate < 0 {
+		return -1
+	}
+	capacity := float64(s.Speed) * 1000 * 1000 / 8
+	return percent(max(s.RxBytesRate, s.TxBytesRate), capacity)
+}
+
+func readSysClassNet(iface string, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(sysClassNetDir, iface, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readInterfaceCounters returns the traffic counters of iface from /proc/net/dev
+func readInterfaceCounters(iface string) (*interfaceCounters, error) {
+	fh, err := os.Open(filepath.Join(procDir, "net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		name, data, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(name) != iface {
+			continue
+		}
+		fields := strings.Fields(data)
+		if len(fields) < 10 {
+			return nil, fmt.Errorf("Malformed counters for interface %s", iface)
+		}
+		values := make([]float64, 10)
+		for i := range values {
+			if values[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+				return nil, err
+			}
+		}
+		return &interfaceCounters{
+			RxBytes: values[0], RxPackets: values[1],
+			TxBytes: values[8], TxPackets: values[9],
+			ReadAt: time.Now(),
+		}, nil
+	}
+	return nil, fmt.Errorf("Cannot find interface %s", iface)
+}
+
+// NetworkCheck defines a check monitoring the link state and traffic
+// of a network interface
+type NetworkCheck struct {
+	*check
+	// Interface contains the name of the monitored network interface
+	Interface string
+	stats     syncValue
+	lastLink  syncValue
+	checkedAt syncTime
+}
+
+func newNetworkCheck(c *check) *NetworkCheck {
+	return &NetworkCheck{check: c}
+}
+
+func (c *NetworkCheck) getStats() *networkStats {
+	if stats, ok := c.stats.Get().(*networkStats); ok {
+		return stats
+	}
+	return nil
+}
+
+// collectStats reads the current state of the interface. Interfaces that
+// disappear or cannot be read are reported with their link down, keeping the
+// counters last read so the rates can be computed again once they are back
+func (c *NetworkCheck) collectStats() (*networkStats, error) {
+	if c.Interface == "" {
+		return nil, fmt.Errorf("No interface configured")
+	}
+	stats := &networkStats{Speed: -1, RxBytesRate: -1, RxPacketsRate: -1, TxBytesRate: -1, TxPacketsRate: -1}
+	previous := c.getStats()
+	if previous != nil {
+		stats.interfaceCounters = previous.interfaceCounters
+	}
+	operState, err := readSysClassNet(c.Interface, "operstate")
+	if err != nil {
+		stats.Unavailable = true
+		return stats, err
+	}
+	// Virtual interfaces such as loopback report an unknown state,
+	// so we fall back to the carrier
+	stats.Link = operState == "up"
+	if operState == "unknown" {
+		carrier, _ := readSysClassNet(c.Interface, "carrier")
+		stats.Link = carrier == "1"
+	}
+	if speed, err := readSysClassNet(c.Interface, "speed"); err == nil {
+		if n, err := strconv.Atoi(speed); err == nil && n > 0 {
+			stats.Speed = n
+		}
+	}
+
+	counters, err := readInterfaceCounters(c.Interface)
+	if err != nil {
+		stats.Unavailable = true
+		return stats, err
+	}
+	stats.interfaceCounters = *counters
+	// Rates are computed from the counters last read
+	if previous != nil && !previous.ReadAt.IsZero() {
+		if elapsed := counters.ReadAt.Sub(previous.ReadAt).Seconds(); elapsed > 0 && counters.RxBytes >= previous.RxBytes && counters.TxBytes >= previous.TxBytes {
+			stats.RxBytesRate = (counters.RxBytes - previous.RxBytes) / elapsed
+			stats.RxPacketsRate = (counters.RxPackets - previous.RxPackets) / elapsed
+			stats.TxBytesRate = (counters.TxBytes - previous.TxBytes) / elapsed
+			stats.TxPacketsRate = (counters.TxPackets - previous.TxPackets) / elapsed
+		}
+	}
+	return stats, nil
+}
+
+func (c *NetworkCheck) getStatusString() (str string) {
+	switch {
+	case !c.IsMonitored():
+		str = c.getMonitoredString()
+	case c.checkedAt.Get().Equal(time.Time{}):
+		str = "Initializing"
+	case c.getStats() == nil || c.getStats().Unavailable:
+		str = "Data access error"
+	case c.failedRule() != nil:
+		str = c.failedRule().Condition.Failure
+	default:
+		str = "OK"
+	}
+	return str
+}
+
+// SummaryText returns a string the a short summary of the check status:
+// Network id       OK
+func (c *NetworkCheck) SummaryText() string {
+	return fmt.Sprintf("Network %-10s%40s", c.ID, c.getStatusString())
+}
+
+func formatTransferRate(bytesRate, packetsRate float64) string {
+	if bytesRate < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s/s [%.0f packets/s]", formatSize(bytesRate), packetsRate)
+}
+
+// String returns a string representation for the network check
+func (c *NetworkCheck) String() string {
+	s := fmt.Sprintf("Network '%s'\n", c.ID)
+	if c.IsMonitored() {
+		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString())
+		s += fmt.Sprintf("  %-40s %12s\n", "interface", c.Interface)
+		if stats := c.getStats(); stats != nil {
+			s += fmt.Sprintf("  %-40s %12s\n", "link", stats.LinkString())
+			s += fmt.Sprintf("  %-40s %12s\n", "speed", stats.SpeedString())
+			s += fmt.Sprintf("  %-40s %12s\n", "download", formatTransferRate(stats.RxBytesRate, stats.RxPacketsRate))
+			s += fmt.Sprintf("  %-40s %12s\n", "upload", formatTransferRate(stats.TxBytesRate, stats.TxPacketsRate))
+			s += fmt.Sprintf("  %-40s %12s\n", "total download", formatSize(stats.RxBytes))
+			s += fmt.Sprintf("  %-40s %12s\n", "total upload", formatSize(stats.TxBytes))
+		}
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
+	} else {
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
+	}
+	return s
+}
+
+// Perform makes the network check collect the current interface state
+// and evaluate all of its conditions
+func (c *NetworkCheck) Perform() {
+	c.logger.Infof("Performing network check %s", c.ID)
+	stats, err := c.collectStats()
+	if err != nil {
+		c.logger.Warnf("Error reading network information for %s: %s", c.ID, err.Error())
+	}
+	c.stats.Set(stats)
+	c.checkedAt.Set(time.Now())
+	c.evaluateRules()
+	c.logger.MDebugf(c.String())
+}
+
+// Parse reads a string containing a monit-like network configuration text
+// and loads the specified settings
+func (c *NetworkCheck) Parse(data string) {
+	c.parseStatements(data, c.parseCondition, func(kind, value string) bool {
+		if kind != "interface" {
+			return false
+		}
+		c.Interface = value
+		return true
+	})
+}
+
+func (c *NetworkCheck) parseCondition(text string) (*condition, error) {
+	switch {
+	case linkDownCondRe.MatchString(text):
+		return &condition{Text: text, Failure: "Link down", test: func() (bool, string) {
+			stats := c.getStats()
+			if stats == nil {
+				return false, ""
+			}
+			return !stats.Link, fmt.Sprintf("link down on interface %s", c.Interface)
+		}}, nil
+	case linkChangedCondRe.MatchString(text):
+		return &condition{Text: text, Failure: "Link changed", test: c.testLinkChanged}, nil
+	case saturationCondRe.MatchString(text):
+		m := saturationCondRe.FindStringSubmatch(text)
+		op := m[1]
+		limit, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Text: text, Failure: "Saturation failed", test: func() (bool, string) {
+			stats := c.getStats()
+			if stats == nil || stats.Saturation() < 0 {
+				return false, ""
+			}
+			return compare(op, stats.Saturation(), limit),
+				fmt.Sprintf("saturation test failed for interface %s -- current saturation is %.1f%%", c.Interface, stats.Saturation())
+		}}, nil
+	case transferCondRe.MatchString(text):
+		m := transferCondRe.FindStringSubmatch(text)
+		direction, op, unit := m[1], m[2], m[4]
+		packets := strings.HasPrefix(unit, "packet")
+		var limit float64
+		var err error
+		if packets {
+			limit, err = strconv.ParseFloat(m[3], 64)
+		} else {
+			limit, err = parseSize(m[3], unit)
+		}
+		if err != nil {
+			return nil, err
+		}
+		failure := fmt.Sprintf("%s%s failed", strings.ToUpper(direction[0:1]), direction[1:])
+		return &condition{Text: text, Failure: failure, test: func() (bool, string) {
+			stats := c.getStats()
+			if stats == nil || stats.RxBytesRate < 0 {
+				return false, ""
+			}
+			bytesRate, packetsRate := stats.RxBytesRate, stats.RxPacketsRate
+			if direction == "upload" {
+				bytesRate, packetsRate = stats.TxBytesRate, stats.TxPacketsRate
+			}
+			current := bytesRate
+			if packets {
+				current = packetsRate
+			}
+			return compare(op, current, limit), fmt.Sprintf("%s test failed for interface %s -- current %s rate is %s",
+				direction, c.Interface, direction, formatTransferRate(bytesRate, packetsRate))
+		}}, nil
+	}
+	return nil, fmt.Errorf("Unknown condition %q", text)
+}
+
+func (c *NetworkCheck) testLinkChanged() (bool, string) {
+	stats := c.getStats()
+	if stats == nil {
+		return false, ""
+	}
+	current := fmt.Sprintf("%s (%s)", stats.LinkString(), stats.SpeedString())
+	previous, ok := c.lastLink.Get().(string)
+	c.lastLink.Set(current)
+	if !ok || previous == current {
+		return false, ""
+	}
+	return true, fmt.Sprintf("link changed on interface %s from %s to %s", c.Interface, previous, current)
+}
@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNetworkCheck(t *testing.T, rules string) *NetworkCheck {
+	return newTestCheck[*NetworkCheck](t, "check network eth0 with interface eth0\n"+rules)
+}
+
+func writeNetDev(t *testing.T, rxBytes, rxPackets, txBytes, txPackets int) {
+	writeFakeProc(t, procDir, map[string]string{
+		"net/dev": "Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo: 100 1 0 0 0 0 0 0 100 1 0 0 0 0 0 0\n" +
+			fmt.Sprintf("  eth0: %d %d 0 0 0 0 0 0 %d %d 0 0 0 0 0 0\n", rxBytes, rxPackets, txBytes, txPackets),
+	})
+}
+
+func TestNetworkCheckParse(t *testing.T) {
+	nc := newTestNetworkCheck(t, `
+  if link down then alert
+  if changed link then alert
+  if upload > 500 MB/s then alert
+  if download > 1000 packets/s then alert
+  if saturation > 90% then alert
+`)
+	assert.Equal(t, "eth0", nc.Interface)
+	assert.Len(t, nc.rules, 5)
+}
+
+func TestNetworkCheckConditions(t *testing.T) {
+	defer func(p, s string) { procDir, sysClassNetDir = p, s }(procDir, sysClassNetDir)
+	procDir, _ = sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	sb.Mkdir(filepath.Join(procDir, "net"), os.FileMode(0755))
+	sysClassNetDir, _ = sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	ifaceDir, _ := sb.Mkdir(filepath.Join(sysClassNetDir, "eth0"), os.FileMode(0755))
+	sb.Write(filepath.Join(ifaceDir, "operstate"), "up\n")
+	sb.Write(filepath.Join(ifaceDir, "speed"), "100\n")
+	writeNetDev(t, 1000, 10, 2000, 20)
+
+	nc := newTestNetworkCheck(t, `
+  if link down then alert
+  if changed link then alert
+  if upload > 5 MB/s then alert
+  if download > 100 packets/s then alert
+  if saturation > 50% then alert
+`)
+	assert.Equal(t, "Initializing", nc.getStatusString())
+	nc.Perform()
+	assert.Equal(t, "OK", nc.getStatusString())
+	stats := nc.getStats()
+	require.NotNil(t, stats)
+	assert.True(t, stats.Link)
+	assert.Equal(t, 100, stats.Speed)
+	// Rates are unknown until the second cycle
+	assert.Equal(t, float64(-1), stats.TxBytesRate)
+
+	// Simulate one second elapsed between cycles
+	stats.ReadAt = stats.ReadAt.Add(-time.Second)
+	writeNetDev(t, 1000+1024, 10+500, 2000+8*1024*1024, 20+10)
+	nc.Perform()
+	stats = nc.getStats()
+	assert.InDelta(t, 8*1024*1024, stats.TxBytesRate, 0.1*1024*1024)
+	assert.InDelta(t, 500, stats.RxPacketsRate, 10)
+	assert.InDelta(t, 67.1, stats.Saturation(), 1)
+	for i, expected := range []bool{false, false, true, true, true} {
+		assert.Equal(t, expected, nc.rules[i].matched.Get(), "Unexpected result for %q", nc.rules[i].Condition)
+	}
+	assert.Equal(t, "Upload failed", nc.getStatusString())
+	assert.Regexp(t, regexp.MustCompile(`^Network eth0\s+Upload failed$`), nc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(
+		`^Network 'eth0'\n\s+status\s+Upload failed\n\s+interface\s+eth0\n\s+link\s+up\n\s+speed\s+100 Mb/s\n`+
+			`\s+download\s+[0-9.]+ k?B/s \[\d+ packets/s\]\n\s+upload\s+[0-9.]+ MB/s \[\d+ packets/s\]\n`+
+			`\s+total download\s+2.0 kB\n\s+total upload\s+8.0 MB\n\s+rule 'link down'\s+ok\n\s+rule 'changed link'\s+ok\n`+
+			`\s+rule 'upload > 5 MB/s'\s+failed\n\s+rule 'download > 100 packets/s'\s+failed\n\s+rule 'saturation > 50%'\s+failed\n\s+monitoring status\s+monitored\n$`,
+	), nc.String())
+
+	sb.Write(filepath.Join(ifaceDir, "operstate"), "down\n")
+	nc.Perform()
+	assert.Equal(t, "Link down", nc.getStatusString())
+	assert.True(t, nc.rules[0].matched.Get())
+	assert.True(t, nc.rules[1].matched.Get())
+	nc.Perform()
+	assert.False(t, nc.rules[1].matched.Get())
+
+	// Vanished interfaces are reported with their link down, keeping the
+	// last counters read
+	sb.Write(filepath.Join(ifaceDir, "operstate"), "up\n")
+	nc.Perform()
+	os.RemoveAll(ifaceDir)
+	writeNetDev(t, 0, 0, 0, 0)
+	nc.Perform()
+	assert.Equal(t, "Data access error", nc.getStatusString())
+	assert.True(t, nc.rules[0].matched.Get())
+	assert.True(t, nc.rules[1].matched.Get())
+	_, msg := nc.rules[0].Condition.Test()
+	assert.Equal(t, "link down on interface eth0", msg)
+	stats = nc.getStats()
+	assert.Equal(t, float64(2000+8*1024*1024), stats.TxBytes)
+
+	// Once it is back, rates are computed from the last counters read
+	ifaceDir, _ = sb.Mkdir(filepath.Join(sysClassNetDir, "eth0"), os.FileMode(0755))
+	sb.Write(filepath.Join(ifaceDir, "operstate"), "up\n")
+	stats.ReadAt = stats.ReadAt.Add(-time.Second)
+	writeNetDev(t, 1000+1024, 10+500, 2000+8*1024*1024+1024, 20+10)
+	nc.Perform()
+	assert.False(t, nc.rules[0].matched.Get())
+	assert.True(t, nc.rules[1].matched.Get())
+	assert.InDelta(t, 1024, nc.getStats().TxBytesRate, 100)
+}
@@ -0,0 +1,180 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bitnami/gonit/utils"
+)
+
+var (
+	existenceCondRe  = regexp.MustCompile(`^(does\s+)?not\s+exists?$`)
+	permissionCondRe = regexp.MustCompile(`^failed\s+(permission|perm)\s+([0-7]{3,4})$`)
+	ownerCondRe      = regexp.MustCompile(`^failed\s+(uid|gid)\s+(\"[^\"]+\"|[^\s]+)$`)
+	timestampCondRe  = regexp.MustCompile(`^timestamp\s+` + operatorPattern + `\s+(\d+)\s+` + durationUnitPattern + `$`)
+)
+
+// pathCheck implements the settings and conditions shared by all the checks
+// monitoring a path in the filesystem, such as files or directories
+type pathCheck struct {
+	*check
+	// Path contains the monitored path
+	Path string
+	// kind contains a description of the expected type of the path
+	kind        string
+	isValidType func(os.FileMode) bool
+	info        syncValue
+	checkedAt   syncTime
+}
+
+func newPathCheck(c *check, kind string, isValidType func(os.FileMode) bool) *pathCheck {
+	return &pathCheck{check: c, kind: kind, isValidType: isValidType}
+}
+
+// refresh updates the cached information about the monitored path
+func (c *pathCheck) refresh() {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		c.logger.Debugf("'%s' %s does not exist", c.ID, c.Path)
+		c.info.Set(nil)
+	} else {
+		if !c.isValidType(info.Mode()) {
+			c.logger.Warnf("'%s' %s is not a %s", c.ID, c.Path, c.kind)
+		}
+		c.info.Set(info)
+	}
+	c.checkedAt.Set(time.Now())
+}
+
+// fileInfo returns the information about the path collected in the last
+// check cycle or nil if it did not exist
+func (c *pathCheck) fileInfo() os.FileInfo {
+	if info, ok := c.info.Get().(os.FileInfo); ok {
+		return info
+	}
+	return nil
+}
+
+// validInfo returns the information about the path collected in the last check
+// cycle or nil if it did not exist or had an unexpected type
+func (c *pathCheck) validInfo() os.FileInfo {
+	info := c.fileInfo()
+	if info == nil || !c.isValidType(info.Mode()) {
+		return nil
+	}
+	return info
+}
+
+func (c *pathCheck) getStatusString(okStatus string) (str string) {
+	switch {
+	case !c.IsMonitored():
+		str = c.getMonitoredString()
+	case c.checkedAt.Get().Equal(time.Time{}):
+		str = "Initializing"
+	case c.fileInfo() == nil:
+		str = "Does not exist"
+	case c.validInfo() == nil:
+		str = "Invalid type"
+	case c.failedRule() != nil:
+		str = c.failedRule().Condition.Failure
+	default:
+		str = okStatus
+	}
+	return str
+}
+
+// statusText returns the status lines shared by all the path checks
+func (c *pathCheck) statusText() string {
+	s := fmt.Sprintf("  %-40s %12s\n", "path", c.Path)
+	if info := c.validInfo(); info != nil {
+		st := info.Sys().(*syscall.Stat_t)
+		s += fmt.Sprintf("  %-40s %12s\n", "permission", fmt.Sprintf("%04o", st.Mode&07777))
+		s += fmt.Sprintf("  %-40s %12d\n", "uid", st.Uid)
+		s += fmt.Sprintf("  %-40s %12d\n", "gid", st.Gid)
+		s += fmt.Sprintf("  %-40s %12s\n", "timestamp", info.ModTime().Format(time.RFC1123))
+	}
+	return s
+}
+
+// parse reads the statements shared by all the path checks, using
+// parseCondition to interpret the "if" rules
+func (c *pathCheck) parse(data string, parseCondition func(string) (*condition, error)) {
+	c.parseStatements(data, parseCondition, func(kind, value string) bool {
+		if kind != "path" {
+			return false
+		}
+		c.Path = value
+		return true
+	})
+}
+
+// parseCondition interprets the conditions shared by all path checks. Paths
+// replaced by another type of file, for example a fifo recreated as a regular
+// file, fail the existence condition too
+func (c *pathCheck) parseCondition(text string) (*condition, error) {
+	switch {
+	case existenceCondRe.MatchString(text):
+		return &condition{Text: text, Failure: "Does not exist", test: func() (bool, string) {
+			if c.fileInfo() != nil && c.validInfo() == nil {
+				return true, fmt.Sprintf("%s is not a %s", c.Path, c.kind)
+			}
+			return c.fileInfo() == nil, fmt.Sprintf("%s does not exist", c.Path)
+		}}, nil
+	case permissionCondRe.MatchString(text):
+		m := permissionCondRe.FindStringSubmatch(text)
+		expected, _ := strconv.ParseUint(m[2], 8, 32)
+		return &condition{Text: text, Failure: "Permission failed", test: func() (bool, string) {
+			info := c.validInfo()
+			if info == nil {
+				return false, ""
+			}
+			perm := info.Sys().(*syscall.Stat_t).Mode & 07777
+			return uint64(perm) != expected, fmt.Sprintf("permission test failed for %s -- current permission is %04o", c.Path, perm)
+		}}, nil
+	case ownerCondRe.MatchString(text):
+		m := ownerCondRe.FindStringSubmatch(text)
+		kind, name := m[1], unquote(m[2])
+		lookup := utils.LookupUID
+		if kind == "gid" {
+			lookup = utils.LookupGID
+		}
+		expected, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Text: text, Failure: fmt.Sprintf("%s failed", strings.ToUpper(kind)), test: func() (bool, string) {
+			info := c.validInfo()
+			if info == nil {
+				return false, ""
+			}
+			st := info.Sys().(*syscall.Stat_t)
+			current := int(st.Uid)
+			if kind == "gid" {
+				current = int(st.Gid)
+			}
+			return current != expected, fmt.Sprintf("%s test failed for %s -- current %s is %d", kind, c.Path, kind, current)
+		}}, nil
+	case timestampCondRe.MatchString(text):
+		m := timestampCondRe.FindStringSubmatch(text)
+		op := m[1]
+		limit, err := parseDuration(m[2], m[3])
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Text: text, Failure: "Timestamp failed", test: func() (bool, string) {
+			info := c.validInfo()
+			if info == nil {
+				return false, ""
+			}
+			age := time.Since(info.ModTime())
+			return compare(op, float64(age), float64(limit)),
+				fmt.Sprintf("timestamp test failed for %s -- last modified %v ago", c.Path, utils.RoundDuration(age))
+		}}, nil
+	}
+	return nil, fmt.Errorf("Unknown condition %q", text)
+}
@@ -0,0 +1,338 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	processCPUCondRe    = regexp.MustCompile(`^(cpu|total\s*cpu)\s+` + operatorPattern + `\s+([0-9.]+)\s*%$`)
+	processMemoryCondRe = regexp.MustCompile(`^(mem|memory|total\s*mem|total\s*memory)\s+` + operatorPattern + `\s+([0-9.]+)\s*(%|` + sizeUnitPattern + `)?$`)
+	processCountCondRe  = regexp.MustCompile(`^(children|threads|(total\s*)?file\s*descriptors)\s+` + operatorPattern + `\s+([0-9.]+)\s*(%)?$`)
+)
+
+// processResources contains the resource usage of a process and its descendants
+type processResources struct {
+	Pid int
+	// CPU and TotalCPU contain the percentage of the host CPU time used by the
+	// process, and by the process and its descendants, since the previous
+	// cycle, or -1 if unknown
+	CPU      float64
+	TotalCPU float64
+	// Memory and TotalMemory contain the resident memory of the process, and
+	// of the process and its descendants, in bytes
+	Memory       float64
+	TotalMemory  float64
+	SystemMemory float64
+	// Children contains the number of direct children of the process
+	Children int
+	Threads  int
+	// FileDescriptors and TotalFileDescriptors contain the number of open
+	// files of the process, and of the process and its descendants, or -1 if
+	// unknown
+	FileDescriptors      int
+	TotalFileDescriptors int
+	// MaxFileDescriptors contains the soft limit of open files, or 0 if unlimited or unknown
+	MaxFileDescriptors int
+	// CPU times, in clock ticks, used to compute the percentages in the next cycle
+	ticks       float64
+	totalTicks  float64
+	systemTicks float64
+}
+
+// processChildren returns the stat information of all the processes in the
+// system indexed by the pid of their parent
+func processChildren() (map[int][]*procStat, error) {
+	pids, err := listPids()
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int][]*procStat)
+	for _, pid := range pids {
+		// Processes can finish at any point so errors are ignored
+		if st, err := readProcStat(pid); err == nil {
+			children[st.PPid] = append(children[st.PPid], st)
+		}
+	}
+	return children, nil
+}
+
+// processDescendants returns the stat information of all the processes
+// descending from pid
+func processDescendants(pid int) ([]*procStat, error) {
+	children, err := processChildren()
+	if err != nil {
+		return nil, err
+	}
+	descendants := []*procStat{}
+	pending := []int{pid}
+	for len(pending) > 0 {
+		for _, st := range children[pending[0]] {
+			descendants = append(descendants, st)
+			pending = append(pending, st.Pid)
+		}
+		pending = pending[1:]
+	}
+	return descendants, nil
+}
+
+// countFileDescriptors returns the number of files opened by a process
+func countFileDescriptors(pid int) (int, error) {
+	fds, err := os.ReadDir(filepath.Join(procDir, strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0, err
+	}
+	return len(fds), nil
+}
+
+// readMaxOpenFiles returns the soft limit of open files of a process, or 0
+// if unlimited
+func readMaxOpenFiles(pid int) (int, error) {
+	fh, err := os.Open(filepath.Join(procDir, strconv.Itoa(pid), "limits"))
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 || fields[0] == "unlimited" {
+			return 0, nil
+		}
+		return strconv.Atoi(fields[0])
+	}
+	return 0, fmt.Errorf("Cannot find open files limit in %s", fh.Name())
+}
+
+// collectProcessResources reads the resource usage of the process with the
+// provided pid. CPU percentages are computed from the times elapsed since
+// previous, if it belongs to the same process
+func collectProcessResources(pid int, previous *processResources) (*processResources, error) {
+	st, err := readProcStat(pid)
+	if err != nil {
+		return nil, err
+	}
+	status, err := readProcValues(filepath.Join(procDir, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return nil, err
+	}
+	res := &processResources{
+		Pid: pid, CPU: -1, TotalCPU: -1,
+		Memory: status["VmRSS"], Threads: int(status["Threads"]),
+		FileDescriptors: -1, TotalFileDescriptors: -1, ticks: float64(st.UTime + st.STime),
+	}
+	res.TotalMemory, res.totalTicks = res.Memory, res.ticks
+
+	// Reading the descriptors of processes owned by other users requires privileges
+	if n, err := countFileDescriptors(pid); err == nil {
+		res.FileDescriptors, res.TotalFileDescriptors = n, n
+	}
+
+	descendants, err := processDescendants(pid)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range descendants {
+		if d.PPid == pid {
+			res.Children++
+		}
+		res.totalTicks += float64(d.UTime + d.STime)
+		if s, err := readProcValues(filepath.Join(procDir, strconv.Itoa(d.Pid), "status")); err == nil {
+			res.TotalMemory += s["VmRSS"]
+		}
+		// The total is unknown unless the descriptors of all the processes can be read
+		if n, err := countFileDescriptors(d.Pid); err != nil {
+			res.TotalFileDescriptors = -1
+		} else if res.TotalFileDescriptors >= 0 {
+			res.TotalFileDescriptors += n
+		}
+	}
+	res.MaxFileDescriptors, _ = readMaxOpenFiles(pid)
+
+	if info, err := readMeminfo(); err == nil {
+		res.SystemMemory = info["MemTotal"]
+	}
+	cpu, err := readCPUTimes()
+	if err != nil {
+		return nil, err
+	}
+	res.systemTicks = cpu.Total
+	if previous != nil && previous.Pid == pid {
+		if delta := res.systemTicks - previous.systemTicks; delta > 0 {
+			res.CPU = percent(res.ticks-previous.ticks, delta)
+			// Descendants finishing between cycles take their CPU time with them
+			res.TotalCPU = percent(max(res.totalTicks-previous.totalTicks, 0), delta)
+		}
+	}
+	return res, nil
+}
+
+// resourcesText returns the status lines describing the resource usage
+func (r *processResources) resourcesText() string {
+	formatCPU := func(value float64) string {
+		if value < 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", value)
+	}
+	fds := "-"
+	if r.FileDescriptors >= 0 {
+		fds = strconv.Itoa(r.FileDescriptors)
+		if r.MaxFileDescriptors > 0 {
+			fds += fmt.Sprintf(" [%.1f%%]", percent(float64(r.FileDescriptors), float64(r.MaxFileDescriptors)))
+		}
+	}
+	totalFds := "-"
+	if r.TotalFileDescriptors >= 0 {
+		totalFds = strconv.Itoa(r.TotalFileDescriptors)
+	}
+	s := fmt.Sprintf("  %-40s %12d\n", "threads", r.Threads)
+	s += fmt.Sprintf("  %-40s %12d\n", "children", r.Children)
+	s += fmt.Sprintf("  %-40s %12s\n", "cpu", formatCPU(r.CPU))
+	s += fmt.Sprintf("  %-40s %12s\n", "cpu total", formatCPU(r.TotalCPU))
+	s += fmt.Sprintf("  %-40s %12s\n", "memory", formatUsage(r.Memory, r.SystemMemory))
+	s += fmt.Sprintf("  %-40s %12s\n", "memory total", formatUsage(r.TotalMemory, r.SystemMemory))
+	s += fmt.Sprintf("  %-40s %12s\n", "file descriptors", fds)
+	s += fmt.Sprintf("  %-40s %12s\n", "file descriptors total", totalFds)
+	return s
+}
+
+func (c *ProcessCheck) getResources() *processResources {
+	if res, ok := c.resources.Get().(*processResources); ok {
+		return res
+	}
+	return nil
+}
+
+// updateResources collects the resource usage of the running process
+func (c *ProcessCheck) updateResources() {
+	pid := c.Pid()
+	if pid <= 0 || c.IsNotRunning() {
+		c.resources.Set(nil)
+		return
+	}
+	res, err := collectProcessResources(pid, c.getResources())
+	if err != nil {
+		c.logger.Warnf("Error reading resource usage of %s: %s", c.ID, err.Error())
+		c.resources.Set(nil)
+		return
+	}
+	c.resources.Set(res)
+}
+
+// parseResourceCondition parses conditions over the resource usage of the
+// process. It returns nil if text is not a resource condition
+func (c *ProcessCheck) parseResourceCondition(text string) (*condition, error) {
+	switch {
+	case processCPUCondRe.MatchString(text):
+		m := processCPUCondRe.FindStringSubmatch(text)
+		total, op := m[1] != "cpu", m[2]
+		limit, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			return nil, err
+		}
+		name, failure := "cpu", "CPU usage failed"
+		if total {
+			name, failure = "total cpu", "Total CPU usage failed"
+		}
+		return &condition{Text: text, Failure: failure, test: func() (bool, string) {
+			res := c.getResources()
+			if res == nil {
+				return false, ""
+			}
+			current := res.CPU
+			if total {
+				current = res.TotalCPU
+			}
+			if current < 0 {
+				return false, ""
+			}
+			return compare(op, current, limit), fmt.Sprintf("%s usage test failed -- current %s usage is %.1f%%", name, name, current)
+		}}, nil
+	case processMemoryCondRe.MatchString(text):
+		m := processMemoryCondRe.FindStringSubmatch(text)
+		total, op, unit := strings.HasPrefix(m[1], "total"), m[2], m[4]
+		sizeUnit := unit
+		if unit == "%" {
+			sizeUnit = ""
+		}
+		limit, err := parseSize(m[3], sizeUnit)
+		if err != nil {
+			return nil, err
+		}
+		name, failure := "memory", "Memory usage failed"
+		if total {
+			name, failure = "total memory", "Total memory usage failed"
+		}
+		return &condition{Text: text, Failure: failure, test: func() (bool, string) {
+			res := c.getResources()
+			if res == nil {
+				return false, ""
+			}
+			current := res.Memory
+			if total {
+				current = res.TotalMemory
+			}
+			if unit == "%" {
+				if res.SystemMemory == 0 {
+					return false, ""
+				}
+				return compare(op, percent(current, res.SystemMemory), limit),
+					fmt.Sprintf("%s usage test failed -- current %s usage is %s", name, name, formatUsage(current, res.SystemMemory))
+			}
+			return compare(op, current, limit),
+				fmt.Sprintf("%s usage test failed -- current %s usage is %s", name, name, formatSize(current))
+		}}, nil
+	case processCountCondRe.MatchString(text):
+		m := processCountCondRe.FindStringSubmatch(text)
+		resource, op, isPercent := strings.Join(strings.Fields(m[1]), ""), m[3], m[5] != ""
+		if isPercent && resource != "filedescriptors" {
+			return nil, fmt.Errorf("Percentages are not supported for %s", resource)
+		}
+		limit, err := strconv.ParseFloat(m[4], 64)
+		if err != nil {
+			return nil, err
+		}
+		failure := map[string]string{
+			"children":             "Children failed",
+			"threads":              "Threads failed",
+			"filedescriptors":      "File descriptors failed",
+			"totalfiledescriptors": "Total file descriptors failed",
+		}[resource]
+		return &condition{Text: text, Failure: failure, test: func() (bool, string) {
+			res := c.getResources()
+			if res == nil {
+				return false, ""
+			}
+			current := map[string]int{
+				"children":             res.Children,
+				"threads":              res.Threads,
+				"filedescriptors":      res.FileDescriptors,
+				"totalfiledescriptors": res.TotalFileDescriptors,
+			}[resource]
+			if current < 0 {
+				return false, ""
+			}
+			if isPercent {
+				if res.MaxFileDescriptors == 0 {
+					return false, ""
+				}
+				usage := percent(float64(current), float64(res.MaxFileDescriptors))
+				return compare(op, usage, limit),
+					fmt.Sprintf("%s test failed -- current usage is %d of %d [%.1f%%]", resource, current, res.MaxFileDescriptors, usage)
+			}
+			return compare(op, float64(current), limit),
+				fmt.Sprintf("%s test failed -- current number of %s is %d", resource, resource, current)
+		}}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,143 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFakeProcess writes the /proc/<pid> files read when collecting the
+// resources of a process
+func writeFakeProcess(t *testing.T, dir string, pid, ppid int, ticks int, rssKB int, threads int) {
+	pidDir, _ := sb.Mkdir(filepath.Join(dir, strconv.Itoa(pid)), os.FileMode(0755))
+	writeFakeProc(t, pidDir, map[string]string{
+		"stat": fmt.Sprintf("%d (fake) S %d %d %d 0 -1 4194560 10 0 0 0 %d 0 0 0 20 0 %d 0 100 1000 100 0\n",
+			pid, ppid, pid, pid, ticks, threads),
+		"status": fmt.Sprintf("Name:\tfake\nState:\tS (sleeping)\nVmRSS:\t %d kB\nThreads:\t%d\n", rssKB, threads),
+	})
+}
+
+func setupFakeProcesses(t *testing.T, pid int, ticks int) string {
+	dir, _ := sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	writeFakeProc(t, dir, map[string]string{
+		"stat":    fmt.Sprintf("cpu  %d 0 0 0 0 0 0 0 0 0\nbtime 1700000000\n", ticks*10),
+		"meminfo": "MemTotal:        1048576 kB\nMemFree:          524288 kB\n",
+	})
+	writeFakeProcess(t, dir, pid, 1, ticks, 102400, 4)
+	writeFakeProcess(t, dir, pid+1, pid, ticks/2, 51200, 1)
+	writeFakeProcess(t, dir, pid+2, pid+1, ticks/2, 51200, 1)
+	writeFakeProcess(t, dir, pid+3, 1, ticks, 51200, 1)
+	for _, p := range []int{pid, pid + 1, pid + 2, pid + 3} {
+		sb.Mkdir(filepath.Join(dir, strconv.Itoa(p), "fd"), os.FileMode(0755))
+	}
+	// Descriptors of descendants count towards the total
+	writeFakeProc(t, filepath.Join(dir, strconv.Itoa(pid+1)), map[string]string{"fd/0": ""})
+	writeFakeProc(t, filepath.Join(dir, strconv.Itoa(pid+2)), map[string]string{"fd/0": "", "fd/1": ""})
+	writeFakeProc(t, filepath.Join(dir, strconv.Itoa(pid+3)), map[string]string{"fd/0": ""})
+	writeFakeProc(t, filepath.Join(dir, strconv.Itoa(pid)), map[string]string{
+		"fd/0": "", "fd/1": "", "fd/2": "", "fd/3": "",
+		"limits": "Limit                     Soft Limit           Hard Limit           Units\n" +
+			"Max open files            8                    4096                 files\n",
+	})
+	return dir
+}
+
+func TestCollectProcessResources(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	procDir = setupFakeProcesses(t, 100, 100)
+
+	res, err := collectProcessResources(100, nil)
+	require.NoError(t, err)
+	// Only direct children are counted
+	assert.Equal(t, 1, res.Children)
+	assert.Equal(t, 4, res.Threads)
+	assert.Equal(t, float64(100*1024*1024), res.Memory)
+	assert.Equal(t, float64(200*1024*1024), res.TotalMemory)
+	assert.Equal(t, float64(1024*1024*1024), res.SystemMemory)
+	assert.Equal(t, 4, res.FileDescriptors)
+	assert.Equal(t, 7, res.TotalFileDescriptors)
+	assert.Equal(t, 8, res.MaxFileDescriptors)
+	assert.Equal(t, float64(-1), res.CPU)
+	assert.Equal(t, float64(-1), res.TotalCPU)
+
+	// CPU usage is computed between cycles
+	procDir = setupFakeProcesses(t, 100, 200)
+	res, err = collectProcessResources(100, res)
+	require.NoError(t, err)
+	assert.Equal(t, float64(10), res.CPU)
+	assert.Equal(t, float64(20), res.TotalCPU)
+
+	// But only for the same process
+	res, err = collectProcessResources(101, res)
+	require.NoError(t, err)
+	assert.Equal(t, float64(-1), res.CPU)
+	assert.Equal(t, 1, res.Children)
+	assert.Equal(t, 1, res.FileDescriptors)
+	assert.Equal(t, 3, res.TotalFileDescriptors)
+
+	// The total is unknown if the descriptors of a descendant cannot be read
+	require.NoError(t, os.RemoveAll(filepath.Join(procDir, "102", "fd")))
+	res, err = collectProcessResources(100, res)
+	require.NoError(t, err)
+	assert.Equal(t, 4, res.FileDescriptors)
+	assert.Equal(t, -1, res.TotalFileDescriptors)
+
+	_, err = collectProcessResources(999, nil)
+	assert.Error(t, err)
+}
+
+func TestProcessCheckResourceConditions(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	pid := os.Getpid()
+	pidFile := sb.TempFile()
+	sb.Write(pidFile, strconv.Itoa(pid))
+	c, err := newCheckFromData(fmt.Sprintf(`check process web with pidfile %s
+  if cpu > 5%% for 2 cycles then alert
+  if total cpu > 50%% then alert
+  if totalmem > 150 MB then alert
+  if memory > 50%% then alert
+  if children >= 1 then alert
+  if threads >= 5 then alert
+  if filedescriptors > 40%% then alert
+  if file descriptors > 100 then alert
+  if total file descriptors > 5 then alert
+  if threads > 5%% then alert
+  if totalfiledescriptors > 5%% then alert
+`, pidFile))
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	require.Len(t, pc.rules, 9)
+	procDir = setupFakeProcesses(t, pid, 100)
+	pc.Initialize(Opts{})
+	pc.updateResources()
+	pc.evaluateRules()
+	procDir = setupFakeProcesses(t, pid, 200)
+	pc.updateResources()
+	pc.evaluateRules()
+	for i, expected := range []bool{false, false, true, false, true, false, true, false, true} {
+		assert.Equal(t, expected, pc.rules[i].matched.Get(), "Unexpected state for %q", pc.rules[i].Condition)
+	}
+	procDir = setupFakeProcesses(t, pid, 300)
+	pc.updateResources()
+	pc.evaluateRules()
+	assert.True(t, pc.rules[0].matched.Get())
+
+	assert.Regexp(t, regexp.MustCompile(
+		`\n\s+threads\s+4\n\s+children\s+1\n\s+cpu\s+10.0%\n\s+cpu total\s+20.0%\n`+
+			`\s+memory\s+100.0 MB \[9.8%\]\n\s+memory total\s+200.0 MB \[19.5%\]\n\s+file descriptors\s+4 \[50.0%\]\n\s+file descriptors total\s+7\n`+
+			`\s+rule 'cpu > 5%'\s+failed\n`,
+	), pc.String())
+
+	// Resources are not reported for stopped processes
+	sb.Write(pidFile, "999999999")
+	pc.updateResources()
+	pc.evaluateRules()
+	assert.Nil(t, pc.getResources())
+	assert.NotRegexp(t, regexp.MustCompile(`\n\s+children\s+\d+\n`), pc.String())
+}
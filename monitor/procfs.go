@@ -0,0 +1,184 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procDir contains the mount point of the proc filesystem
+var procDir = "/proc"
+
+// clockTicks contains the number of clock ticks per second in which the
+// kernel reports process times (USER_HZ)
+const clockTicks = 100
+
+// procStat contains the fields of /proc/<pid>/stat used by gonit
+type procStat struct {
+	Pid   int
+	Comm  string
+	State string
+	PPid  int
+	// UTime and STime contain the time spent in user and kernel mode, in clock ticks
+	UTime uint64
+	STime uint64
+	// StartTime contains the time the process started after system boot, in clock ticks
+	StartTime uint64
+}
+
+// readProcStat parses /proc/<pid>/stat
+func readProcStat(pid int) (*procStat, error) {
+	data, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil, err
+	}
+	str := string(data)
+	// The command name is enclosed in parentheses and can contain spaces
+	// or parentheses, so we look for the last one
+	start, end := strings.IndexByte(str, '('), strings.LastIndexByte(str, ')')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("Malformed stat data for pid %d", pid)
+	}
+	fields := strings.Fields(str[end+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("Malformed stat data for pid %d", pid)
+	}
+	st := &procStat{Pid: pid, Comm: str[start+1 : end], State: fields[0]}
+	if st.PPid, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, err
+	}
+	for dst, idx := range map[*uint64]int{&st.UTime: 11, &st.STime: 12, &st.StartTime: 19} {
+		if *dst, err = strconv.ParseUint(fields[idx], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// readProcCmdline returns the command line of a process, with its
+// arguments separated by spaces
+func readProcCmdline(pid int) (string, error) {
+	data, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " ")), nil
+}
+
+// readProcValues parses files with "Key: value [kB]" lines, such as
+// /proc/meminfo or /proc/<pid>/status. Sizes are returned in bytes and
+// non-numeric values are ignored
+func readProcValues(path string) (map[string]float64, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	info := make(map[string]float64)
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 2 && strings.ToLower(fields[2]) == "kb" {
+			value *= 1024
+		}
+		info[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	return info, nil
+}
+
+// bootTime returns the time the system booted
+func bootTime() (time.Time, error) {
+	fh, err := os.Open(filepath.Join(procDir, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			secs, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(secs, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Cannot find boot time in %s", fh.Name())
+}
+
+// processStartTime returns the time the process with the provided pid started
+func processStartTime(pid int) (time.Time, error) {
+	st, err := readProcStat(pid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Ticks are converted to seconds first, so long uptimes do not overflow
+	seconds, ticks := st.StartTime/clockTicks, st.StartTime%clockTicks
+	return boot.Add(time.Duration(seconds)*time.Second + time.Duration(ticks)*time.Second/clockTicks), nil
+}
+
+// listPids returns the pids of all the processes in the system, sorted
+func listPids() ([]int, error) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+	pids := []int{}
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// findMatchingProcesses returns the stat information of all the running
+// processes whose command line matches re, sorted from the oldest to the
+// newest. Processes started at the same time are sorted by pid. The
+// current process, kernel threads and zombies are ignored
+func findMatchingProcesses(re *regexp.Regexp) ([]*procStat, error) {
+	pids, err := listPids()
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	matches := []*procStat{}
+	for _, pid := range pids {
+		if pid == self {
+			continue
+		}
+		// Processes can finish at any point so errors are ignored
+		cmdline, err := readProcCmdline(pid)
+		if err != nil || cmdline == "" || !re.MatchString(cmdline) {
+			continue
+		}
+		st, err := readProcStat(pid)
+		if err != nil || st.State == "Z" {
+			continue
+		}
+		matches = append(matches, st)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].StartTime < matches[j].StartTime
+	})
+	return matches, nil
+}
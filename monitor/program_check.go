@@ -0,0 +1,192 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultProgramOutputLines configures how many lines of the program
+// output are kept after every execution
+const defaultProgramOutputLines = 10
+
+var programStatusCondRe = regexp.MustCompile(`^status\s+` + operatorPattern + `\s+(-?\d+)$`)
+
+// ProgramCheck defines a check executing a program on every cycle and
+// evaluating its exit status and output
+type ProgramCheck struct {
+	*check
+	// Program contains the command to execute
+	Program     *Command
+	outputLines int
+	exitCode    syncInt
+	duration    syncValue
+	output      syncValue
+	lastError   syncValue
+	checkedAt   syncTime
+}
+
+func newProgramCheck(c *check) *ProgramCheck {
+	return &ProgramCheck{check: c, outputLines: defaultProgramOutputLines}
+}
+
+// Initialize fills up any unconfigured program attributes,
+// for example, the logger
+func (c *ProgramCheck) Initialize(opts Opts) {
+	c.check.Initialize(opts)
+	if c.Program == nil {
+		c.Program = newCommand("", c.Timeout, opts)
+	}
+	c.Program.logger = c.logger
+	if c.Program.Timeout == 0 {
+		c.Program.Timeout = c.Timeout
+	}
+}
+
+// ExitCode returns the exit code of the last program execution
+func (c *ProgramCheck) ExitCode() int {
+	return c.exitCode.Get()
+}
+
+// Duration returns for how long the last program execution lasted
+func (c *ProgramCheck) Duration() time.Duration {
+	if d, ok := c.duration.Get().(time.Duration); ok {
+		return d
+	}
+	return 0
+}
+
+// Output returns the last lines of the output of the last program execution
+func (c *ProgramCheck) Output() []string {
+	if lines, ok := c.output.Get().([]string); ok {
+		return lines
+	}
+	return nil
+}
+
+func (c *ProgramCheck) executionError() error {
+	if err, ok := c.lastError.Get().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// lastLines returns the last n lines of text
+func lastLines(text string, n int) []string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func (c *ProgramCheck) getStatusString() (str string) {
+	switch {
+	case !c.IsMonitored():
+		str = c.getMonitoredString()
+	case c.checkedAt.Get().Equal(time.Time{}):
+		str = "Initializing"
+	case c.executionError() != nil:
+		str = "Execution failed"
+	case c.failedRule() != nil:
+		str = c.failedRule().Condition.Failure
+	default:
+		str = "Status ok"
+	}
+	return str
+}
+
+// SummaryText returns a string the a short summary of the check status:
+// Program id       Status ok
+func (c *ProgramCheck) SummaryText() string {
+	return fmt.Sprintf("Program %-10s%40s", c.ID, c.getStatusString())
+}
+
+// String returns a string representation for the program check
+func (c *ProgramCheck) String() string {
+	s := fmt.Sprintf("Program '%s'\n", c.ID)
+	if c.IsMonitored() {
+		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString())
+		s += fmt.Sprintf("  %-40s %12s\n", "path", c.Program.Cmd)
+		if checkedAt := c.checkedAt.Get(); !checkedAt.Equal(time.Time{}) {
+			s += fmt.Sprintf("  %-40s %12s\n", "last executed", checkedAt.Format(time.RFC1123))
+			s += fmt.Sprintf("  %-40s %12d\n", "last exit value", c.ExitCode())
+			s += fmt.Sprintf("  %-40s %12s\n", "last execution time", fmt.Sprintf("%.3fs", c.Duration().Seconds()))
+			if err := c.executionError(); err != nil {
+				s += fmt.Sprintf("  %-40s %12s\n", "last error", err.Error())
+			}
+			if lines := c.Output(); len(lines) > 0 {
+				s += "  last output\n"
+				for _, line := range lines {
+					s += fmt.Sprintf("    %s\n", line)
+				}
+			}
+		}
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
+	} else {
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
+	}
+	return s
+}
+
+// Perform makes the program check execute its program, recording its
+// exit code, duration and output, and evaluate all of its conditions
+func (c *ProgramCheck) Perform() {
+	c.logger.Infof("Performing program check %s", c.ID)
+	start := time.Now()
+	out, exitCode, err := c.Program.Output()
+	c.duration.Set(time.Since(start))
+	if err != nil {
+		c.logger.Warnf("Error executing program for %s: %s", c.ID, err.Error())
+	}
+	c.lastError.Set(err)
+	c.exitCode.Set(exitCode)
+	c.output.Set(lastLines(string(out), c.outputLines))
+	c.checkedAt.Set(time.Now())
+	c.evaluateRules()
+	c.logger.MDebugf(c.String())
+}
+
+// Parse reads a string containing a monit-like program configuration text
+// and loads the specified settings
+func (c *ProgramCheck) Parse(data string) {
+	c.parseStatements(data, c.parseCondition, func(kind, value string) bool {
+		if kind != "path" {
+			return false
+		}
+		c.Program = newCommand(value, 0, Opts{Logger: c.logger})
+		return true
+	})
+}
+
+// parseCondition parses the program check conditions. Programs failing to
+// execute, for example because of a timeout, fail any status condition
+func (c *ProgramCheck) parseCondition(text string) (*condition, error) {
+	if m := programStatusCondRe.FindStringSubmatch(text); m != nil {
+		op := m[1]
+		limit, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Text: text, Failure: "Status failed", test: func() (bool, string) {
+			if c.checkedAt.Get().Equal(time.Time{}) {
+				return false, ""
+			}
+			if err := c.executionError(); err != nil {
+				return true, fmt.Sprintf("status test failed for %s -- %s", c.Program.Cmd, err.Error())
+			}
+			exitCode := c.ExitCode()
+			msg := fmt.Sprintf("status test failed for %s -- exit value is %d", c.Program.Cmd, exitCode)
+			return compare(op, float64(exitCode), float64(limit)), msg
+		}}, nil
+	}
+	return nil, fmt.Errorf("Unknown condition %q", text)
+}
@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProgramCheck(t *testing.T, path string, rules string) *ProgramCheck {
+	return newTestCheck[*ProgramCheck](t, fmt.Sprintf("check program script\n  with path %q\n%s", path, rules))
+}
+
+func writeScript(t *testing.T, content string) string {
+	script, err := sb.WriteFile(sb.TempFile(), []byte("#!/bin/bash\n"+content), os.FileMode(0755))
+	require.NoError(t, err)
+	return script
+}
+
+func TestProgramCheckParse(t *testing.T) {
+	pc := newTestProgramCheck(t, "/opt/check.sh", `  with timeout 10 seconds
+  if status != 0 then alert
+  if status > 2 then alert
+`)
+	assert.Equal(t, "/opt/check.sh", pc.Program.Cmd)
+	assert.Equal(t, 10*time.Second, pc.Timeout)
+	assert.Equal(t, 10*time.Second, pc.Program.Timeout)
+	require.Len(t, pc.rules, 2)
+	assert.Equal(t, "status != 0", pc.rules[0].Condition.String())
+}
+
+func TestLastLines(t *testing.T) {
+	assert.Equal(t, []string{}, lastLines("", 3))
+	assert.Equal(t, []string{"a", "b"}, lastLines("a\nb\n", 3))
+	assert.Equal(t, []string{"c", "d"}, lastLines("a\nb\nc\nd", 2))
+}
+
+func TestProgramCheckConditions(t *testing.T) {
+	statusFile := sb.TempFile()
+	script := writeScript(t, fmt.Sprintf(`for i in $(seq 1 15); do echo "line $i"; done
+exit $(cat %s 2>/dev/null || echo 0)
+`, statusFile))
+	pc := newTestProgramCheck(t, script, `
+  if status != 0 then alert
+  if status > 2 then alert
+`)
+	assert.Equal(t, "Initializing", pc.getStatusString())
+	pc.Perform()
+	assert.Equal(t, "Status ok", pc.getStatusString())
+	assert.Equal(t, 0, pc.ExitCode())
+	assert.True(t, pc.Duration() > 0)
+	require.Len(t, pc.Output(), defaultProgramOutputLines)
+	assert.Equal(t, "line 15", pc.Output()[defaultProgramOutputLines-1])
+
+	sb.Write(statusFile, "1")
+	pc.Perform()
+	assert.Equal(t, "Status failed", pc.getStatusString())
+	assert.Equal(t, 1, pc.ExitCode())
+	assert.True(t, pc.rules[0].matched.Get())
+	assert.False(t, pc.rules[1].matched.Get())
+
+	assert.Regexp(t, regexp.MustCompile(`^Program script\s+Status failed$`), pc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(
+		`^Program 'script'\n\s+status\s+Status failed\n\s+path\s+.*\n\s+last executed\s+.*\n`+
+			`\s+last exit value\s+1\n\s+last execution time\s+[0-9.]+s\n\s+last output\n    line 6\n(    line \d+\n){8}    line 15\n`+
+			`\s+rule 'status != 0'\s+failed\n\s+rule 'status > 2'\s+ok\n\s+monitoring status\s+monitored\n$`,
+	), pc.String())
+}
+
+func TestProgramCheckTimeout(t *testing.T) {
+	pc := newTestProgramCheck(t, writeScript(t, "echo started\nsleep 10\n"), `  with timeout 200 milliseconds
+  if status != 0 then alert
+  if status > 0 then alert
+  if status = 2 then alert
+  if status < 3 then alert
+`)
+	start := time.Now()
+	pc.Perform()
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, "Execution failed", pc.getStatusString())
+	assert.Equal(t, -1, pc.ExitCode())
+	// Timeouts fail the status conditions, whatever the operator
+	for _, r := range pc.rules {
+		assert.True(t, r.matched.Get(), "Expected rule %q to fail", r.Condition)
+	}
+	_, msg := pc.rules[0].Condition.Test()
+	assert.Contains(t, msg, "-- Timed out after 200ms")
+	assert.Contains(t, pc.String(), "Timed out after 200ms")
+}
+
+func TestProgramCheckExecutionError(t *testing.T) {
+	pc := newTestProgramCheck(t, "/bin/true", `
+  if status > 0 then alert
+  if status = 2 then alert
+`)
+	pc.Program.Dir = sb.Normalize("missing")
+	pc.Perform()
+	assert.Equal(t, "Execution failed", pc.getStatusString())
+	for _, r := range pc.rules {
+		assert.True(t, r.matched.Get(), "Expected rule %q to fail", r.Condition)
+	}
+}
@@ -0,0 +1,293 @@
+package monitor
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxExpectBuffer limits the amount of data read while waiting for an
+// expected server answer
+const maxExpectBuffer = 4096
+
+// protocolTester defines the interface of the application protocol tests
+// performed over an established port test connection
+type protocolTester interface {
+	// Test performs the protocol exchange over conn, returning an error if
+	// the server does not answer as expected
+	Test(conn net.Conn, address string) error
+}
+
+// protocolParser returns a new protocolTester configured with the options
+// provided in the port test definition
+type protocolParser func(options string) (protocolTester, error)
+
+var (
+	protocols          = make(map[string]protocolParser)
+	protocolRe         = regexp.MustCompile(`protocol\s+([^\s]+)`)
+	sendExpectRe       = regexp.MustCompile(`(send|expect)\s+("(?:[^"\\]|\\.)*")`)
+	httpRequestRe      = regexp.MustCompile(`request\s+(\"[^\"]+\"|[^\s]+)`)
+	httpHostHeaderRe   = regexp.MustCompile(`hostheader\s+(\"[^\"]+\"|[^\s]+)`)
+	httpStatusRe       = regexp.MustCompile(`status\s+` + operatorPattern + `\s+(\d+)`)
+	httpContentRe      = regexp.MustCompile(`content\s+(=|==|!=)\s+("(?:[^"\\]|\\.)*")`)
+	redisPingResponse  = "+PONG"
+	smtpReadyCode      = "220"
+	mysqlProtocolV10   = byte(0x0a)
+	mysqlErrorResponse = byte(0xff)
+)
+
+// registerProtocol makes a protocol available to port tests
+// with the syntax "protocol <name> [options]"
+func registerProtocol(name string, parser protocolParser) {
+	protocols[name] = parser
+}
+
+// parseProtocol returns the protocol tester referenced in a port test
+// options text, if any
+func parseProtocol(options string) (string, protocolTester, error) {
+	if m := protocolRe.FindStringSubmatch(options); m != nil {
+		name := strings.ToLower(m[1])
+		parser, ok := protocols[name]
+		if !ok {
+			return "", nil, fmt.Errorf("Unknown protocol %s", name)
+		}
+		tester, err := parser(options)
+		return name, tester, err
+	}
+	if sendExpectRe.MatchString(options) {
+		tester, err := parseSendExpect(options)
+		return "generic", tester, err
+	}
+	return "", nil, nil
+}
+
+// sendExpectTester implements a generic protocol test sending and
+// expecting a sequence of strings
+type sendExpectTester struct {
+	steps []sendExpectStep
+}
+
+type sendExpectStep struct {
+	send   string
+	expect *regexp.Regexp
+}
+
+func parseSendExpect(options string) (protocolTester, error) {
+	tester := &sendExpectTester{}
+	for _, m := range sendExpectRe.FindAllStringSubmatch(options, -1) {
+		str, err := strconv.Unquote(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("Malformed %s string %s", m[1], m[2])
+		}
+		if m[1] == "send" {
+			tester.steps = append(tester.steps, sendExpectStep{send: str})
+			continue
+		}
+		re, err := regexp.Compile(str)
+		if err != nil {
+			return nil, err
+		}
+		tester.steps = append(tester.steps, sendExpectStep{expect: re})
+	}
+	return tester, nil
+}
+
+func (t *sendExpectTester) Test(conn net.Conn, address string) error {
+	reader := bufio.NewReader(conn)
+	for _, step := range t.steps {
+		if step.expect != nil {
+			if err := expect(reader, step.expect); err != nil {
+				return err
+			}
+		} else if _, err := io.WriteString(conn, step.send); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expect reads from reader until the data received matches re
+func expect(reader *bufio.Reader, re *regexp.Regexp) error {
+	received := []byte{}
+	buff := make([]byte, 512)
+	for len(received) < maxExpectBuffer {
+		n, err := reader.Read(buff)
+		received = append(received, buff[:n]...)
+		if re.Match(received) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Expected %q but got %q: %s", re.String(), received, err.Error())
+		}
+	}
+	return fmt.Errorf("Expected %q but got %q", re.String(), received)
+}
+
+// httpTester implements the HTTP and HTTPS protocol tests
+type httpTester struct {
+	useTLS     bool
+	path       string
+	hostHeader string
+	statusOp   string
+	status     int
+	content    *regexp.Regexp
+	notContent bool
+}
+
+func newHTTPParser(useTLS bool) protocolParser {
+	return func(options string) (protocolTester, error) {
+		t := &httpTester{useTLS: useTLS, path: "/", statusOp: "<", status: 400}
+		if m := httpRequestRe.FindStringSubmatch(options); m != nil {
+			t.path = unquote(m[1])
+		}
+		if m := httpHostHeaderRe.FindStringSubmatch(options); m != nil {
+			t.hostHeader = unquote(m[1])
+		}
+		if m := httpStatusRe.FindStringSubmatch(options); m != nil {
+			t.statusOp = m[1]
+			t.status, _ = strconv.Atoi(m[2])
+		}
+		if m := httpContentRe.FindStringSubmatch(options); m != nil {
+			str, err := strconv.Unquote(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("Malformed content string %s", m[2])
+			}
+			if t.content, err = regexp.Compile(str); err != nil {
+				return nil, err
+			}
+			t.notContent = m[1] == "!="
+		}
+		return t, nil
+	}
+}
+
+func (t *httpTester) Test(conn net.Conn, address string) error {
+	host := t.hostHeader
+	if host == "" {
+		host = address
+	}
+	if t.useTLS {
+		serverName, _, err := net.SplitHostPort(host)
+		if err != nil {
+			serverName = host
+		}
+		// As monit does, we only care about the service answering
+		// so certificates are not verified
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		conn = tlsConn
+	}
+	req, err := http.NewRequest("GET", t.path, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = host
+	req.Header.Set("Connection", "close")
+	req.Header.Set("User-Agent", "gonit")
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !compare(t.statusOp, float64(resp.StatusCode), float64(t.status)) {
+		return fmt.Errorf("HTTP error: server returned status %d", resp.StatusCode)
+	}
+	if t.content != nil {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		if err != nil {
+			return err
+		}
+		if t.content.Match(body) == t.notContent {
+			return fmt.Errorf("HTTP error: content test failed for %q", t.content.String())
+		}
+	}
+	return nil
+}
+
+// redisTester checks the server answers to a PING command
+type redisTester struct{}
+
+func (t *redisTester) Test(conn net.Conn, address string) error {
+	if _, err := io.WriteString(conn, "PING\r\n"); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, redisPingResponse) {
+		return fmt.Errorf("REDIS error: unexpected PING response %q", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// mysqlTester checks the server sends a valid protocol greeting
+type mysqlTester struct{}
+
+func (t *mysqlTester) Test(conn net.Conn, address string) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if length == 0 {
+		return fmt.Errorf("MYSQL error: empty greeting packet")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return err
+	}
+	switch payload[0] {
+	case mysqlProtocolV10:
+		return nil
+	case mysqlErrorResponse:
+		msg := ""
+		if len(payload) > 3 {
+			msg = string(payload[3:])
+		}
+		return fmt.Errorf("MYSQL error: server returned error %q", msg)
+	default:
+		return fmt.Errorf("MYSQL error: unsupported protocol version %d", payload[0])
+	}
+}
+
+// smtpTester checks the server greets with a 220 banner
+type smtpTester struct{}
+
+func (t *smtpTester) Test(conn net.Conn, address string) error {
+	reader := bufio.NewReader(conn)
+	// Banners can span multiple lines ("220-...") until a "220 " line is found
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, smtpReadyCode) {
+			return fmt.Errorf("SMTP error: unexpected banner %q", strings.TrimSpace(line))
+		}
+		if len(line) < 4 || line[3] != '-' {
+			break
+		}
+	}
+	_, err := io.WriteString(conn, "QUIT\r\n")
+	return err
+}
+
+func init() {
+	registerProtocol("http", newHTTPParser(false))
+	registerProtocol("https", newHTTPParser(true))
+	registerProtocol("redis", func(string) (protocolTester, error) { return &redisTester{}, nil })
+	registerProtocol("mysql", func(string) (protocolTester, error) { return &mysqlTester{}, nil })
+	registerProtocol("smtp", func(string) (protocolTester, error) { return &smtpTester{}, nil })
+}
@@ -0,0 +1,187 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveTCP starts a fake server calling handler for every accepted connection
+func serveTCP(t *testing.T, handler func(conn net.Conn)) (net.Listener, int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handler(conn)
+			}()
+		}
+	}()
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+func runProtocolTest(t *testing.T, port int, options string) error {
+	pt, err := newPortTest("tcp", fmt.Sprintf("127.0.0.1:%d", port), options+" with timeout 1 second")
+	require.NoError(t, err)
+	return pt.Run()
+}
+
+func TestParseProtocol(t *testing.T) {
+	name, tester, err := parseProtocol(`protocol http request "/health" status = 200 content = "ok"`)
+	require.NoError(t, err)
+	assert.Equal(t, "http", name)
+	ht, ok := tester.(*httpTester)
+	require.True(t, ok, "Expected a *httpTester but got %T", tester)
+	assert.Equal(t, "/health", ht.path)
+	assert.Equal(t, 200, ht.status)
+	assert.Equal(t, "ok", ht.content.String())
+
+	name, tester, err = parseProtocol(`send "PING\r\n" expect "^PONG"`)
+	require.NoError(t, err)
+	assert.Equal(t, "generic", name)
+	require.Len(t, tester.(*sendExpectTester).steps, 2)
+	assert.Equal(t, "PING\r\n", tester.(*sendExpectTester).steps[0].send)
+
+	name, tester, err = parseProtocol("type tcp")
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+	assert.Nil(t, tester)
+
+	_, _, err = parseProtocol("protocol gopher")
+	assert.EqualError(t, err, "Unknown protocol gopher")
+
+	pt, err := newPortTest("tcp", "127.0.0.1:6379", "protocol redis")
+	require.NoError(t, err)
+	assert.Equal(t, "port 6379/tcp [REDIS]", pt.String())
+}
+
+func TestHTTPProtocol(t *testing.T) {
+	for _, newServer := range []func(http.Handler) *httptest.Server{httptest.NewServer, httptest.NewTLSServer} {
+		server := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/health":
+				fmt.Fprint(w, "status: ok")
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		u, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		protocol := "http"
+		if u.Scheme == "https" {
+			protocol = "https"
+		}
+		var port int
+		fmt.Sscanf(u.Port(), "%d", &port)
+
+		assert.NoError(t, runProtocolTest(t, port, fmt.Sprintf(`protocol %s request "/health" status = 200 content = "ok"`, protocol)))
+		assert.NoError(t, runProtocolTest(t, port, fmt.Sprintf(`protocol %s request "/health" content != "error"`, protocol)))
+		assert.Error(t, runProtocolTest(t, port, fmt.Sprintf(`protocol %s request "/health" content = "^error"`, protocol)))
+		assert.Error(t, runProtocolTest(t, port, fmt.Sprintf(`protocol %s request "/missing"`, protocol)))
+		assert.NoError(t, runProtocolTest(t, port, fmt.Sprintf(`protocol %s request "/missing" status = 404`, protocol)))
+		server.Close()
+	}
+}
+
+func TestRedisProtocol(t *testing.T) {
+	// Every case gets its own server, as handlers from previous cases
+	// may still be running
+	for answer, expectedErr := range map[string]string{
+		"+PONG\r\n":                            "",
+		"-NOAUTH Authentication required.\r\n": `REDIS error: unexpected PING response "-NOAUTH Authentication required."`,
+	} {
+		ln, port := serveTCP(t, func(conn net.Conn) {
+			if line, _ := bufio.NewReader(conn).ReadString('\n'); line == "PING\r\n" {
+				io.WriteString(conn, answer)
+			}
+		})
+		err := runProtocolTest(t, port, "protocol redis")
+		if expectedErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, expectedErr)
+		}
+		ln.Close()
+	}
+}
+
+func TestMySQLProtocol(t *testing.T) {
+	for _, tc := range []struct {
+		payload     []byte
+		expectedErr string
+	}{
+		{append([]byte{0x0a}, []byte("8.0.36\x00")...), ""},
+		{append([]byte{0xff, 0x6a, 0x04}, []byte("Host is blocked")...), `MYSQL error: server returned error "Host is blocked"`},
+	} {
+		ln, port := serveTCP(t, func(conn net.Conn) {
+			conn.Write(append([]byte{byte(len(tc.payload)), 0, 0, 0}, tc.payload...))
+		})
+		err := runProtocolTest(t, port, "protocol mysql")
+		if tc.expectedErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.expectedErr)
+		}
+		ln.Close()
+	}
+}
+
+func TestSMTPProtocol(t *testing.T) {
+	for banner, valid := range map[string]bool{
+		"220-mail.example.com ESMTP\r\n220 ready\r\n": true,
+		"554 no service\r\n":                          false,
+	} {
+		ln, port := serveTCP(t, func(conn net.Conn) {
+			io.WriteString(conn, banner)
+			if line, _ := bufio.NewReader(conn).ReadString('\n'); line == "QUIT\r\n" {
+				io.WriteString(conn, "221 bye\r\n")
+			}
+		})
+		err := runProtocolTest(t, port, "protocol smtp")
+		if valid {
+			assert.NoError(t, err, "Expected banner %q to be accepted", banner)
+		} else {
+			assert.Error(t, err, "Expected banner %q to be rejected", banner)
+		}
+		ln.Close()
+	}
+}
+
+func TestSendExpectProtocol(t *testing.T) {
+	ln, port := serveTCP(t, func(conn net.Conn) {
+		io.WriteString(conn, "HELLO v1.2\n")
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		io.WriteString(conn, strings.ToUpper(line))
+	})
+	defer ln.Close()
+	assert.NoError(t, runProtocolTest(t, port, `expect "^HELLO v[0-9.]+" send "echo\n" expect "ECHO"`))
+	assert.Error(t, runProtocolTest(t, port, `expect "^HELLO v[0-9.]+" send "echo\n" expect "echo"`))
+}
+
+func TestHostCheckProtocol(t *testing.T) {
+	ln, port := serveTCP(t, func(conn net.Conn) {
+		bufio.NewReader(conn).ReadString('\n')
+		io.WriteString(conn, "+PONG\r\n")
+	})
+	defer ln.Close()
+	hc := newTestHostCheck(t, fmt.Sprintf(`with address 127.0.0.1
+  if failed port %d protocol redis with timeout 1 second then alert
+`, port))
+	hc.Perform()
+	assert.Equal(t, "Online", hc.getStatusString())
+	assert.Contains(t, hc.String(), fmt.Sprintf("port %d/tcp [REDIS] response time", port))
+}
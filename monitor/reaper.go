@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// prSetChildSubreaper is the prctl option making the orphaned descendants
+// of a process be reparented to it instead of to PID 1
+const prSetChildSubreaper = 36
+
+var (
+	// childrenMutex serializes starting child processes with reaping zombies,
+	// so the reaper never collects a child before it is registered
+	childrenMutex sync.Mutex
+	// ownChildren contains the pids of the child processes whose exit status
+	// is collected by their exec.Cmd, which the reaper must leave alone
+	ownChildren = make(map[int]struct{})
+)
+
+// startChild starts cmd, registering it so ReapZombies does not collect it
+func startChild(cmd *exec.Cmd) error {
+	defer childrenMutex.Unlock()
+	childrenMutex.Lock()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	ownChildren[cmd.Process.Pid] = struct{}{}
+	return nil
+}
+
+// waitChild waits for a child started with startChild to finish
+func waitChild(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	childrenMutex.Lock()
+	delete(ownChildren, cmd.Process.Pid)
+	childrenMutex.Unlock()
+	return err
+}
+
+func runChild(cmd *exec.Cmd) error {
+	if err := startChild(cmd); err != nil {
+		return err
+	}
+	return waitChild(cmd)
+}
+
+// combinedOutputChild works as cmd.CombinedOutput for children started
+// with startChild
+func combinedOutputChild(cmd *exec.Cmd) ([]byte, error) {
+	var b bytes.Buffer
+	cmd.Stdout = &b
+	cmd.Stderr = &b
+	err := runChild(cmd)
+	return b.Bytes(), err
+}
+
+// ReapZombies collects the exit status of the finished child processes not
+// started by the monitor itself, which it adopts when running as PID 1 or as
+// a subreaper. It returns how many were reaped
+func ReapZombies() int {
+	defer childrenMutex.Unlock()
+	childrenMutex.Lock()
+	children, err := processChildren()
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, st := range children[os.Getpid()] {
+		if _, ok := ownChildren[st.Pid]; ok || st.State != "Z" {
+			continue
+		}
+		var ws syscall.WaitStatus
+		if pid, err := syscall.Wait4(st.Pid, &ws, syscall.WNOHANG, nil); err == nil && pid == st.Pid {
+			n++
+		}
+	}
+	return n
+}
+
+// BecomeSubreaper makes the orphaned descendants of the monitor be
+// reparented to it, so they can be reaped when not running as PID 1
+func BecomeSubreaper() error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bitnami/gonit/log"
+	"github.com/bitnami/gonit/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func isZombie(pid int) bool {
+	st, err := readProcStat(pid)
+	return err == nil && st.State == "Z"
+}
+
+func TestReapZombies(t *testing.T) {
+	// Children started by the monitor are left for their exec.Cmd
+	own := exec.Command("true")
+	require.NoError(t, startChild(own))
+	require.True(t, utils.WaitUntil(func() bool { return isZombie(own.Process.Pid) }, 2*time.Second, 50*time.Millisecond))
+	ReapZombies()
+	assert.True(t, isZombie(own.Process.Pid))
+	assert.NoError(t, waitChild(own))
+
+	orphan := exec.Command("true")
+	require.NoError(t, orphan.Start())
+	require.True(t, utils.WaitUntil(func() bool { return isZombie(orphan.Process.Pid) }, 2*time.Second, 50*time.Millisecond))
+	assert.True(t, ReapZombies() >= 1)
+	assert.False(t, isZombie(orphan.Process.Pid))
+}
+
+func newShutdownMonitor(t *testing.T, l *operationsLog) (*Monitor, map[string]*loggedService) {
+	app, err := New(Config{StateFile: sb.TempFile()})
+	require.NoError(t, err)
+	services := map[string]*loggedService{}
+	for _, s := range []*loggedService{
+		newLoggedService("apache", l, "mysql"),
+		newLoggedService("mysql", l),
+		newLoggedService("cron", l),
+	} {
+		require.NoError(t, app.AddCheck(s))
+		s.Initialize(Opts{Logger: log.DummyLogger()})
+		services[s.ID] = s
+	}
+	require.Empty(t, app.StartAll())
+	return app, services
+}
+
+func TestMonitorShutdown(t *testing.T) {
+	l := &operationsLog{}
+	app, services := newShutdownMonitor(t, l)
+	services["cron"].SetMonitored(false)
+	l.entries = nil
+
+	require.NoError(t, app.Shutdown(5*time.Second))
+	assert.Equal(t, []string{"stop apache", "stop mysql", "stop cron"}, l.entries)
+	for id, s := range services {
+		assert.True(t, s.IsNotRunning(), "Expected %s to be stopped", id)
+	}
+	// Monitored services are started again on the next run
+	assert.False(t, services["apache"].IsMonitored())
+	assert.True(t, app.database.GetEntry("apache").Monitored)
+	assert.True(t, app.database.GetEntry("mysql").Monitored)
+	assert.False(t, app.database.GetEntry("cron").Monitored)
+	// Even if the database is updated again
+	require.NoError(t, app.UpdateDatabase())
+	assert.True(t, app.database.GetEntry("apache").Monitored)
+
+	// Checks are no longer performed
+	app.Perform()
+	assert.True(t, services["apache"].IsNotRunning())
+}
+
+func TestMonitorShutdownErrors(t *testing.T) {
+	app, services := newShutdownMonitor(t, &operationsLog{})
+	services["mysql"].stopTime = 2 * time.Second
+	assert.Equal(t, ErrShutdownTimeout, app.Shutdown(500*time.Millisecond))
+	// The services not stopped yet are no longer supervised
+	for id, s := range services {
+		assert.False(t, s.IsMonitored(), "Expected %s to be unmonitored", id)
+		assert.True(t, app.database.GetEntry(id).Monitored)
+	}
+
+	app, services = newShutdownMonitor(t, &operationsLog{})
+	services["cron"].doError = true
+	assert.EqualError(t, app.Shutdown(5*time.Second), "Error stopping services:\nError stopping service cron")
+}
+
+func TestMonitorShutdownKillsProcessGroups(t *testing.T) {
+	pidFile, childPidFile := sb.TempFile(), sb.TempFile()
+	ctrlFile, err := sb.WriteFile(sb.TempFile(), []byte(fmt.Sprintf(`
+check process web with pidfile %s
+  stop program = "sleep 30" with timeout 30 seconds
+`, pidFile)), os.FileMode(0600))
+	require.NoError(t, err)
+	app, err := New(Config{ControlFile: ctrlFile, StateFile: sb.TempFile()})
+	require.NoError(t, err)
+
+	startProcessGroup(t, fmt.Sprintf("sleep 30 & echo $! > %s; wait", childPidFile), pidFile)
+	require.True(t, utils.WaitUntil(func() bool { return utils.FileExists(childPidFile) }, 2*time.Second, 50*time.Millisecond))
+	childPid, err := utils.ReadPid(childPidFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrShutdownTimeout, app.Shutdown(500*time.Millisecond))
+	// The children of the service are killed too
+	assert.True(t, utils.WaitUntil(func() bool { return !utils.IsProcessRunning(childPid) }, 2*time.Second, 100*time.Millisecond))
+}
+
+func TestMonitorSignalAll(t *testing.T) {
+	pidFile := sb.TempFile()
+	ctrlFile, err := sb.WriteFile(sb.TempFile(), []byte(fmt.Sprintf(`
+check process web with pidfile %s
+check process other with pidfile %s
+`, pidFile, sb.TempFile())), os.FileMode(0600))
+	require.NoError(t, err)
+	app, err := New(Config{ControlFile: ctrlFile})
+	require.NoError(t, err)
+
+	startProcessGroup(t, `trap "exit 3" USR1; sleep 30 & wait`, pidFile)
+	time.Sleep(200 * time.Millisecond)
+	web := app.checks[0].(*ProcessCheck)
+	require.True(t, web.IsRunning())
+	assert.Empty(t, app.SignalAll(syscall.SIGUSR1))
+	assert.True(t, utils.WaitUntil(web.IsNotRunning, 2*time.Second, 100*time.Millisecond))
+}
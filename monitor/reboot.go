@@ -0,0 +1,154 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Policies applied to the monitored status of the checks after a reboot,
+// configured globally with "set onreboot" or per check with "onreboot"
+const (
+	// OnRebootStart monitors, and thus starts, the checks after a reboot
+	OnRebootStart = "start"
+	// OnRebootNoStart leaves the checks unmonitored after a reboot
+	OnRebootNoStart = "nostart"
+	// OnRebootLastState restores the monitored status the checks had before
+	// the reboot. This is the default
+	OnRebootLastState = "laststate"
+)
+
+// bootIDKey is the database key storing the boot id seen in the last run.
+// It contains spaces so it cannot clash with check ids
+const bootIDKey = "gonit boot id"
+
+var onRebootRe = regexp.MustCompile(`onreboot\s+(start|nostart|laststate)`)
+
+func isOnRebootPolicy(policy string) bool {
+	switch policy {
+	case OnRebootStart, OnRebootNoStart, OnRebootLastState:
+		return true
+	}
+	return false
+}
+
+// readBootID returns the id the kernel generated for the current boot
+func readBootID() (string, error) {
+	data, err := os.ReadFile(filepath.Join(procDir, "sys", "kernel", "random", "boot_id"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// BootID returns the boot id stored in the database or an empty string if
+// there is none
+func (cd *ChecksDatabase) BootID() string {
+	id, _ := cd.Get(bootIDKey).(string)
+	return id
+}
+
+// SetBootID stores the boot id in the database
+func (cd *ChecksDatabase) SetBootID(id string) {
+	cd.Set(bootIDKey, id)
+}
+
+// Keys returns the ids of the check entries stored, leaving out the boot id
+func (cd *ChecksDatabase) Keys() []string {
+	keys := []string{}
+	for _, k := range cd.Storer.Keys() {
+		if k != bootIDKey {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// detectReboot returns true if the system was rebooted since the boot id
+// was last stored in the database, updating it. The first run is not
+// considered a reboot
+func (m *Monitor) detectReboot() bool {
+	id, err := readBootID()
+	if err != nil {
+		m.logger.Debugf("Cannot read boot id: %s", err.Error())
+		return false
+	}
+	previous := m.database.BootID()
+	m.database.SetBootID(id)
+	return previous != "" && previous != id
+}
+
+// parseOnReboot configures the check reboot policy from an "onreboot" statement
+func (c *check) parseOnReboot(statement string) {
+	m := onRebootRe.FindStringSubmatch(statement)
+	if m == nil {
+		c.logger.Warnf("Ignoring malformed onreboot policy for %s: %q", c.ID, statement)
+		return
+	}
+	c.OnReboot = m[1]
+}
+
+func (c *check) onRebootPolicy() string {
+	return c.OnReboot
+}
+
+// onRebootCheck defines the interface of the checks that can override the
+// global reboot policy
+type onRebootCheck interface {
+	onRebootPolicy() string
+}
+
+// setOnReboot configures the global reboot policy
+func (m *Monitor) setOnReboot(policy string) error {
+	if !isOnRebootPolicy(policy) {
+		return fmt.Errorf("Invalid onreboot policy %q", policy)
+	}
+	m.onReboot = policy
+	return nil
+}
+
+// rebootPolicy returns the reboot policy applying to c
+func (m *Monitor) rebootPolicy(c interface {
+	Checkable
+}) string {
+	if rc, ok := c.(onRebootCheck); ok && rc.onRebootPolicy() != "" {
+		return rc.onRebootPolicy()
+	}
+	if m.onReboot != "" {
+		return m.onReboot
+	}
+	return OnRebootLastState
+}
+
+// handleReboot applies the onreboot policies to the registered checks if the
+// system was rebooted since the daemon last run, storing the current boot id.
+// Only the daemon calls it, so commands run without a daemon do not hide the
+// reboot from the next daemon run. Checks registered later, for example when
+// reloading, are not affected by the reboot
+func (m *Monitor) handleReboot() {
+	if m.detectReboot() {
+		for _, c := range m.checks {
+			m.applyRebootPolicy(c)
+		}
+	}
+	if err := m.UpdateDatabase(); err != nil {
+		m.logger.Warnf("Error updating database: %s", err.Error())
+	}
+}
+
+// applyRebootPolicy sets the monitored status of a check in the first daemon
+// run after a reboot
+func (m *Monitor) applyRebootPolicy(c interface {
+	Checkable
+}) {
+	policy := m.rebootPolicy(c)
+	switch policy {
+	case OnRebootStart:
+		c.SetMonitored(true)
+	case OnRebootNoStart:
+		c.SetMonitored(false)
+	}
+	m.logger.Infof("System rebooted, applying onreboot %s policy to %s", policy, c.GetID())
+}
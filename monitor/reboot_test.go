@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFakeBootID returns a fake proc directory reporting the provided boot id
+func setupFakeBootID(t *testing.T, id string) string {
+	dir := sb.TempFile()
+	_, err := sb.Mkdir(filepath.Join(dir, "sys", "kernel", "random"), os.FileMode(0755))
+	require.NoError(t, err)
+	_, err = sb.Write(filepath.Join(dir, "sys", "kernel", "random", "boot_id"), id+"\n")
+	require.NoError(t, err)
+	return dir
+}
+
+func monitoredStatus(app *Monitor) map[string]bool {
+	status := map[string]bool{}
+	for _, c := range app.checks {
+		status[c.GetID()] = c.IsMonitored()
+	}
+	return status
+}
+
+func TestParseOnReboot(t *testing.T) {
+	c, err := newCheckFromData(`check process web with pidfile /tmp/web.pid
+  start program = "/bin/true"
+  onreboot nostart
+`)
+	require.NoError(t, err)
+	assert.Equal(t, OnRebootNoStart, c.(*ProcessCheck).OnReboot)
+	assert.Equal(t, "/bin/true", c.(*ProcessCheck).StartProgram.Cmd)
+
+	fc := newTestFileCheck(t, "/etc/hosts", "  onreboot laststate\n  if does not exist then alert\n")
+	assert.Equal(t, OnRebootLastState, fc.OnReboot)
+	assert.Len(t, fc.rules, 1)
+
+	cv := newValidator()
+	cv.SetAttribute("onreboot", "sometimes")
+	assert.False(t, cv.Success)
+}
+
+func TestDetectReboot(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	procDir = setupFakeBootID(t, "boot-1")
+	app, err := New(Config{})
+	require.NoError(t, err)
+	// The first run is not a reboot
+	assert.False(t, app.detectReboot())
+	assert.Equal(t, "boot-1", app.database.BootID())
+	assert.False(t, app.detectReboot())
+
+	procDir = setupFakeBootID(t, "boot-2")
+	assert.True(t, app.detectReboot())
+	assert.Equal(t, "boot-2", app.database.BootID())
+	assert.False(t, app.detectReboot())
+
+	// The boot id is not reported as a check entry
+	assert.Empty(t, app.database.Keys())
+}
+
+func TestMonitorOnReboot(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	procDir = setupFakeBootID(t, "boot-1")
+	dbFile := sb.TempFile()
+	ctrlFile, err := sb.WriteFile(sb.TempFile(), []byte(fmt.Sprintf(`
+set onreboot nostart
+check process web with pidfile %s
+check process db with pidfile %s
+  onreboot start
+check process cache with pidfile %s
+  onreboot laststate
+`, sb.TempFile(), sb.TempFile(), sb.TempFile())), os.FileMode(0600))
+	require.NoError(t, err)
+	cfg := Config{ControlFile: ctrlFile, StateFile: dbFile}
+
+	// The daemon stores the boot id in its first run
+	app, err := New(cfg)
+	require.NoError(t, err)
+	app.handleReboot()
+	assert.Equal(t, map[string]bool{"web": true, "db": true, "cache": true}, monitoredStatus(app))
+	assert.Empty(t, app.UnmonitorAll())
+	require.NoError(t, app.Monitor("web"))
+
+	// Without rebooting, the last state is always restored
+	app, err = New(cfg)
+	require.NoError(t, err)
+	app.handleReboot()
+	assert.Equal(t, map[string]bool{"web": true, "db": false, "cache": false}, monitoredStatus(app))
+
+	// Commands run without a daemon after rebooting do not consume the reboot
+	procDir = setupFakeBootID(t, "boot-2")
+	app, err = New(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"web": true, "db": false, "cache": false}, monitoredStatus(app))
+	require.NoError(t, app.Unmonitor("cache"))
+	assert.Equal(t, "boot-1", app.database.BootID())
+
+	app, err = New(cfg)
+	require.NoError(t, err)
+	app.handleReboot()
+	assert.Equal(t, map[string]bool{"web": false, "db": true, "cache": false}, monitoredStatus(app))
+	assert.Equal(t, OnRebootNoStart, app.rebootPolicy(app.FindCheck("web")))
+	assert.Equal(t, "boot-2", app.database.BootID())
+
+	// The policies are applied only once
+	require.NoError(t, app.Monitor("web"))
+	app, err = New(cfg)
+	require.NoError(t, err)
+	app.handleReboot()
+	assert.True(t, app.FindCheck("web").IsMonitored())
+}
@@ -0,0 +1,248 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ruleRe = regexp.MustCompile(`(?s)^if\s+(.+?)(\s+for\s+(\d+)\s+cycles?|\s+(\d+)\s+times?\s+within\s+(\d+)\s+cycles?)?` +
+		`\s+then\s+(.+?)(\s+else\s+if\s+(succeeded|passed|recovered)\s+then\s+(.+))?$`)
+	actionRe = regexp.MustCompile(`(?s)^(alert|restart|start|stop|unmonitor|exec\s+(\"[^\"]+\"|.+))$`)
+)
+
+// ruleAction defines an action to take when a rule changes its state
+type ruleAction struct {
+	// Name contains the kind of action (alert, restart, start, stop, exec or unmonitor)
+	Name string
+	// Command contains the command to call for exec actions
+	Command string
+}
+
+func parseAction(text string) (*ruleAction, error) {
+	m := actionRe.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil {
+		return nil, fmt.Errorf("Unsupported action %q", text)
+	}
+	if m[2] != "" {
+		return &ruleAction{Name: "exec", Command: unquote(strings.TrimSpace(m[2]))}, nil
+	}
+	return &ruleAction{Name: m[1]}, nil
+}
+
+func (a *ruleAction) String() string {
+	if a.Name == "exec" {
+		return fmt.Sprintf("exec %q", a.Command)
+	}
+	return a.Name
+}
+
+// rule associates a condition with the actions to take when it fails
+// and, optionally, when it recovers
+type rule struct {
+	Condition *condition
+	// Times configures how many times the condition must be met within the
+	// last Cycles evaluations for the rule to fail
+	Times  int
+	Cycles int
+	// Action is triggered when the rule fails
+	Action *ruleAction
+	// ElseAction is triggered when a failed rule succeeds again, if not nil
+	ElseAction *ruleAction
+	history    syncValue
+	matched    syncBool
+}
+
+func newRule(cond *condition, action *ruleAction) *rule {
+	r := &rule{Condition: cond, Action: action, Times: 1, Cycles: 1}
+	r.matched.Set(false)
+	return r
+}
+
+func parseRule(statement string, parseCondition func(string) (*condition, error)) (*rule, error) {
+	m := ruleRe.FindStringSubmatch(strings.TrimSpace(statement))
+	if m == nil {
+		return nil, fmt.Errorf("Malformed rule %q", statement)
+	}
+	cond, err := parseCondition(strings.Join(strings.Fields(m[1]), " "))
+	if err != nil {
+		return nil, err
+	}
+	action, err := parseAction(m[6])
+	if err != nil {
+		return nil, err
+	}
+	r := newRule(cond, action)
+	switch {
+	case m[3] != "":
+		r.Times, _ = strconv.Atoi(m[3])
+		r.Cycles = r.Times
+	case m[4] != "":
+		r.Times, _ = strconv.Atoi(m[4])
+		r.Cycles, _ = strconv.Atoi(m[5])
+	}
+	if r.Times < 1 || r.Cycles < r.Times {
+		return nil, fmt.Errorf("Invalid number of cycles in rule %q", statement)
+	}
+	if m[9] != "" {
+		if r.ElseAction, err = parseAction(m[9]); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *rule) getHistory() []bool {
+	if h, ok := r.history.Get().([]bool); ok {
+		return h
+	}
+	return []bool{}
+}
+
+// hits returns how many times the condition was met within the last Cycles evaluations
+func (r *rule) hits() int {
+	n := 0
+	for _, matched := range r.getHistory() {
+		if matched {
+			n++
+		}
+	}
+	return n
+}
+
+// update records the result of a condition evaluation and returns true if
+// the rule changed its state
+func (r *rule) update(conditionMatched bool) bool {
+	h := append(r.getHistory(), conditionMatched)
+	if len(h) > r.Cycles {
+		h = h[len(h)-r.Cycles:]
+	}
+	r.history.Set(h)
+	wasMatched := r.matched.Get()
+	matched := r.hits() >= r.Times
+	r.matched.Set(matched)
+	return matched != wasMatched
+}
+
+// State returns a short description of the rule state
+func (r *rule) State() string {
+	if r.matched.Get() {
+		return "failed"
+	}
+	if hits := r.hits(); hits > 0 {
+		return fmt.Sprintf("ok (%d/%d)", hits, r.Times)
+	}
+	return "ok"
+}
+
+func (r *rule) String() string {
+	s := fmt.Sprintf("if %s", r.Condition)
+	if r.Cycles > 1 {
+		if r.Times == r.Cycles {
+			s += fmt.Sprintf(" for %d cycles", r.Cycles)
+		} else {
+			s += fmt.Sprintf(" %d times within %d cycles", r.Times, r.Cycles)
+		}
+	}
+	s += fmt.Sprintf(" then %s", r.Action)
+	if r.ElseAction != nil {
+		s += fmt.Sprintf(" else if succeeded then %s", r.ElseAction)
+	}
+	return s
+}
+
+// evaluateRules tests the conditions of all the check rules, running the
+// actions of the ones changing state
+func (c *check) evaluateRules() {
+	for _, r := range c.rules {
+		conditionMatched, msg := r.Condition.Test()
+		if !r.update(conditionMatched) {
+			continue
+		}
+		if r.matched.Get() {
+			c.logger.Warnf("'%s' %s", c.ID, msg)
+			c.runAction(r.Action)
+		} else {
+			c.logger.Infof("'%s' %s succeeded", c.ID, r.Condition)
+			if r.ElseAction != nil {
+				c.runAction(r.ElseAction)
+			}
+		}
+	}
+}
+
+// runAction executes a rule action over the check
+func (c *check) runAction(a *ruleAction) {
+	var owner interface {
+		Checkable
+	} = c
+	if c.owner != nil {
+		owner = c.owner
+	}
+	switch a.Name {
+	case "alert":
+		// The event was already reported when evaluating the rule
+	case "unmonitor":
+		c.logger.Infof("'%s' unmonitor action triggered", c.ID)
+		owner.SetMonitored(false)
+	case "exec":
+		c.logger.Infof("'%s' exec action triggered: %s", c.ID, a.Command)
+		cmd := newCommand(a.Command, c.Timeout, Opts{Logger: c.logger})
+		if _, exitCode, err := cmd.Output(); err != nil {
+			c.logger.Warnf("'%s' error executing %q: %s", c.ID, a.Command, err.Error())
+		} else if exitCode != 0 {
+			c.logger.Warnf("'%s' %q exited with status %d", c.ID, a.Command, exitCode)
+		}
+	case "start", "stop", "restart":
+		p, ok := owner.(interface {
+			CheckableProcess
+		})
+		if !ok {
+			c.logger.Warnf("'%s' cannot %s: it is not a process check", c.ID, a.Name)
+			return
+		}
+		if c.isPassive() {
+			c.logger.Infof("'%s' %s action ignored in passive mode", c.ID, a.Name)
+			return
+		}
+		if a.Name != "stop" && startsSuspended(p) {
+			c.logger.Warnf("'%s' %s action ignored after too many start attempts", c.ID, a.Name)
+			return
+		}
+		c.logger.Infof("'%s' %s action triggered", c.ID, a.Name)
+		operation := map[string]func(interface {
+			CheckableProcess
+		}) error{"start": startProcess, "stop": stopProcess, "restart": restartProcess}[a.Name]
+		if a.Name == "restart" && c.restartHandler != nil {
+			operation = c.restartHandler
+		}
+		if a.Name != "stop" {
+			recordStartAttempt(p)
+		}
+		if err := operation(p); err != nil {
+			c.logger.Warnf("'%s' %s action failed: %s", c.ID, a.Name, err.Error())
+		}
+	}
+}
+
+// failedRule returns the first rule that failed during the last
+// evaluation or nil if all of them succeeded
+func (c *check) failedRule() *rule {
+	for _, r := range c.rules {
+		if r.matched.Get() {
+			return r
+		}
+	}
+	return nil
+}
+
+// rulesText returns the status lines describing the state of the check rules
+func (c *check) rulesText() string {
+	s := ""
+	for _, r := range c.rules {
+		s += fmt.Sprintf("  %-40s %12s\n", fmt.Sprintf("rule '%s'", r.Condition), r.State())
+	}
+	return s
+}
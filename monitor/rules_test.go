@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/bitnami/gonit/log"
+	"github.com/bitnami/gonit/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCondition returns a condition whose result is controlled by the
+// returned pointer
+func newTestCondition(text string) (*condition, *bool) {
+	result := false
+	return &condition{Text: text, Failure: "Test failed", test: func() (bool, string) {
+		return result, text + " failed"
+	}}, &result
+}
+
+func parseTestCondition(text string) (*condition, error) {
+	cond, _ := newTestCondition(text)
+	return cond, nil
+}
+
+func TestParseRule(t *testing.T) {
+	for statement, expected := range map[string]string{
+		"if foo then alert":                                            "if foo then alert",
+		"if foo > 3 for 3 cycles then restart":                         "if foo > 3 for 3 cycles then restart",
+		"if foo 2 times within 5 cycles then stop":                     "if foo 2 times within 5 cycles then stop",
+		"if foo then exec \"/bin/notify --all\"":                       `if foo then exec "/bin/notify --all"`,
+		"if foo then alert else if succeeded then exec /bin/resume":    `if foo then alert else if succeeded then exec "/bin/resume"`,
+		"if foo\n    then unmonitor\n    else if recovered then start": "if foo then unmonitor else if succeeded then start",
+	} {
+		r, err := parseRule(statement, parseTestCondition)
+		require.NoError(t, err, "Unexpected error parsing %q", statement)
+		assert.Equal(t, expected, r.String())
+	}
+	r, _ := parseRule("if foo 2 times within 5 cycles then stop", parseTestCondition)
+	assert.Equal(t, 2, r.Times)
+	assert.Equal(t, 5, r.Cycles)
+	assert.Equal(t, "foo", r.Condition.String())
+
+	for _, statement := range []string{
+		"if foo then reboot",
+		"if foo 5 times within 2 cycles then alert",
+		"if foo for 0 cycles then alert",
+		"if foo",
+	} {
+		_, err := parseRule(statement, parseTestCondition)
+		assert.Error(t, err, "Expected %q to fail", statement)
+	}
+}
+
+func TestRuleCycles(t *testing.T) {
+	cond, result := newTestCondition("foo")
+	r := newRule(cond, &ruleAction{Name: "alert"})
+	r.Times, r.Cycles = 2, 3
+	for i, step := range []struct {
+		result   bool
+		changed  bool
+		matched  bool
+		expected string
+	}{
+		{true, false, false, "ok (1/2)"},
+		{false, false, false, "ok (1/2)"},
+		{true, true, true, "failed"},
+		{true, false, true, "failed"},
+		{false, false, true, "failed"},
+		{false, true, false, "ok (1/2)"},
+		{false, false, false, "ok"},
+	} {
+		*result = step.result
+		matched, _ := r.Condition.Test()
+		assert.Equal(t, step.changed, r.update(matched), "Unexpected state change in step %d", i)
+		assert.Equal(t, step.matched, r.matched.Get(), "Unexpected state in step %d", i)
+		assert.Equal(t, step.expected, r.State(), "Unexpected state text in step %d", i)
+	}
+}
+
+func TestEvaluateRulesActions(t *testing.T) {
+	flagFile := sb.TempFile()
+	ds := newDummyService("dummy")
+	ds.Initialize(Opts{Logger: log.DummyLogger()})
+	ds.owner = ds
+	cond, result := newTestCondition("foo")
+	r := newRule(cond, &ruleAction{Name: "start"})
+	r.ElseAction = &ruleAction{Name: "exec", Command: fmt.Sprintf("touch %s", flagFile)}
+	unmonitorCond, unmonitorResult := newTestCondition("bar")
+	ds.rules = []*rule{r, newRule(unmonitorCond, &ruleAction{Name: "unmonitor"})}
+
+	ds.evaluateRules()
+	assert.False(t, ds.IsRunning())
+	*result = true
+	ds.evaluateRules()
+	assert.True(t, ds.IsRunning())
+	assert.Equal(t, 1, ds.getTimesStarted())
+	// Actions only run when the rule changes its state
+	ds.evaluateRules()
+	assert.Equal(t, 1, ds.getTimesStarted())
+	assert.False(t, utils.FileExists(flagFile))
+	*result = false
+	ds.evaluateRules()
+	assert.True(t, utils.FileExists(flagFile))
+	assert.Regexp(t, regexp.MustCompile(`^\s+rule 'foo'\s+ok\n\s+rule 'bar'\s+ok\n$`), ds.rulesText())
+
+	*unmonitorResult = true
+	ds.evaluateRules()
+	assert.False(t, ds.IsMonitored())
+	assert.Regexp(t, regexp.MustCompile(`\s+rule 'bar'\s+failed\n$`), ds.rulesText())
+
+	// Process actions are ignored for other check types
+	fc := newTestFileCheck(t, filepath.Join(sb.Root, "nonexistent"), "  if does not exist then restart\n")
+	fc.Perform()
+	assert.True(t, fc.rules[0].matched.Get())
+	assert.True(t, fc.IsMonitored())
+}
+
+func TestProcessCheckRules(t *testing.T) {
+	ln, port := listenTCP(t)
+	defer ln.Close()
+	pidFile := sb.TempFile()
+	c, err := newCheckFromData(fmt.Sprintf(`check process web with pidfile %s
+  start program = "/bin/true"
+  if failed port %d with timeout 1 second for 2 cycles then restart
+  if uptime > 3 days then alert
+  if does not exist then alert
+`, pidFile, port))
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	require.Len(t, pc.rules, 3)
+	assert.Equal(t, "restart", pc.rules[0].Action.String())
+	assert.Equal(t, 2, pc.rules[0].Cycles)
+
+	pc.Initialize(Opts{})
+	sb.Write(pidFile, fmt.Sprintf("%d", os.Getpid()))
+	pc.evaluateRules()
+	for _, r := range pc.rules {
+		assert.False(t, r.matched.Get(), "Expected %q to not be matched", r.Condition)
+	}
+	assert.Contains(t, pc.String(), fmt.Sprintf("rule 'failed port %d with timeout 1 second'", port))
+
+	sb.Write(pidFile, "999999999")
+	pc.evaluateRules()
+	assert.True(t, pc.rules[2].matched.Get())
+}
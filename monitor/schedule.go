@@ -0,0 +1,235 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var everyRe = regexp.MustCompile(`(not\s+)?every\s+(\"[^\"]+\"|(\d+)\s+cycles?)`)
+
+// cronField contains the values allowed by a field of a cron expression
+type cronField map[int]bool
+
+// cronExpr defines a standard five fields cron expression
+// (minute, hour, day of month, month and day of week)
+type cronExpr struct {
+	minute, hour, dom, month, dow cronField
+	// domRestricted and dowRestricted are used to replicate the cron behavior
+	// of matching any of the days fields if both are restricted
+	domRestricted, dowRestricted bool
+}
+
+// parseCronField parses a comma-separated list of values, ranges and steps
+// (for example, "1,5-10,*/15") with values between min and max
+func parseCronField(text string, min, max int) (cronField, error) {
+	field := cronField{}
+	for _, part := range strings.Split(text, ",") {
+		rangeText, step := part, 1
+		if idx := strings.IndexByte(part, '/'); idx >= 0 {
+			rangeText = part[:idx]
+			var err error
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("Invalid step in %q", part)
+			}
+		}
+		start, end := min, max
+		if rangeText != "*" {
+			bounds := strings.SplitN(rangeText, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("Invalid value %q", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("Invalid value %q", part)
+				}
+			} else if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("Value %q out of range %d-%d", part, min, max)
+		}
+		for v := start; v <= end; v += step {
+			field[v] = true
+		}
+	}
+	return field, nil
+}
+
+func parseCronExpr(text string) (*cronExpr, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Malformed cron expression %q: expected 5 fields", text)
+	}
+	e := &cronExpr{domRestricted: fields[2] != "*", dowRestricted: fields[4] != "*"}
+	var err error
+	for i, spec := range []struct {
+		dst      *cronField
+		min, max int
+	}{{&e.minute, 0, 59}, {&e.hour, 0, 23}, {&e.dom, 1, 31}, {&e.month, 1, 12}, {&e.dow, 0, 7}} {
+		if *spec.dst, err = parseCronField(fields[i], spec.min, spec.max); err != nil {
+			return nil, fmt.Errorf("Malformed cron expression %q: %s", text, err.Error())
+		}
+	}
+	// Both 0 and 7 mean Sunday
+	if e.dow[7] {
+		e.dow[0] = true
+	}
+	return e, nil
+}
+
+func (e *cronExpr) dayMatches(t time.Time) bool {
+	dom, dow := e.dom[t.Day()], e.dow[int(t.Weekday())]
+	if e.domRestricted && e.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Matches returns true if the minute of t is included in the expression
+func (e *cronExpr) Matches(t time.Time) bool {
+	return e.minute[t.Minute()] && e.hour[t.Hour()] && e.month[int(t.Month())] && e.dayMatches(t)
+}
+
+// Next returns the first minute after t matching the expression, or the
+// zero time if there is none in the next years
+func (e *cronExpr) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case !e.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !e.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !e.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !e.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// schedule restricts when a check is performed
+type schedule struct {
+	Text string
+	// Cycles makes the check run only once every Cycles monitor cycles
+	Cycles int
+	// Cron, if not nil, makes the check run only during the minutes matching
+	// it or, if Negated is true, not matching it
+	Cron    *cronExpr
+	Negated bool
+	// cycle counts the monitor cycles since the check last ran
+	cycle   syncInt
+	lastRun syncTime
+}
+
+func parseSchedule(statement string) (*schedule, error) {
+	m := everyRe.FindStringSubmatch(statement)
+	if m == nil {
+		return nil, fmt.Errorf("Malformed schedule %q", statement)
+	}
+	s := &schedule{Text: strings.Join(strings.Fields(statement), " "), Negated: m[1] != ""}
+	if m[3] != "" {
+		if s.Negated {
+			return nil, fmt.Errorf("Cycles cannot be negated in %q", statement)
+		}
+		s.Cycles, _ = strconv.Atoi(m[3])
+		if s.Cycles < 1 {
+			return nil, fmt.Errorf("Invalid number of cycles in %q", statement)
+		}
+		return s, nil
+	}
+	cron, err := parseCronExpr(unquote(m[2]))
+	if err != nil {
+		return nil, err
+	}
+	s.Cron = cron
+	return s, nil
+}
+
+// isDue returns true if the check must be performed in the monitor cycle
+// starting at now
+func (s *schedule) isDue(now time.Time) bool {
+	if s.Cron != nil {
+		if s.Negated {
+			return !s.Cron.Matches(now)
+		}
+		// Cron schedules run once per matching minute
+		if !s.Cron.Matches(now) || s.lastRun.Get().Truncate(time.Minute).Equal(now.Truncate(time.Minute)) {
+			return false
+		}
+		s.lastRun.Set(now)
+		return true
+	}
+	cycle := s.cycle.Get()
+	s.cycle.Set((cycle + 1) % s.Cycles)
+	return cycle == 0
+}
+
+// next returns when the check will be performed next, given the current
+// monitor cycle started at now and cycles last interval
+func (s *schedule) next(now time.Time, interval time.Duration) time.Time {
+	if s.Cron == nil {
+		left := (s.Cycles - s.cycle.Get()) % s.Cycles
+		return now.Add(time.Duration(left+1) * interval)
+	}
+	if !s.Negated {
+		return s.Cron.Next(now)
+	}
+	t := now.Truncate(time.Minute)
+	for limit := t.AddDate(1, 0, 0); t.Before(limit); t = t.Add(time.Minute) {
+		if t.After(now) && !s.Cron.Matches(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// scheduledCheck defines the interface of the checks that can be configured
+// to not be performed on every monitor cycle
+type scheduledCheck interface {
+	isDue(now time.Time) bool
+	updateNextCheck(now time.Time, interval time.Duration)
+}
+
+// parseSchedule configures the check schedule from an "every" statement
+func (c *check) parseSchedule(statement string) {
+	s, err := parseSchedule(statement)
+	if err != nil {
+		c.logger.Warnf("Ignoring schedule for %s: %s", c.ID, err.Error())
+		return
+	}
+	c.schedule = s
+}
+
+func (c *check) isDue(now time.Time) bool {
+	return c.schedule == nil || c.schedule.isDue(now)
+}
+
+func (c *check) updateNextCheck(now time.Time, interval time.Duration) {
+	if c.schedule != nil {
+		c.nextCheck.Set(c.schedule.next(now, interval))
+	}
+}
+
+// scheduleText returns the status lines describing the check schedule
+func (c *check) scheduleText() string {
+	if c.schedule == nil {
+		return ""
+	}
+	next := "-"
+	if t := c.nextCheck.Get(); !t.IsZero() {
+		next = t.Format(time.DateTime)
+	}
+	s := fmt.Sprintf("  %-40s %12s\n", "schedule", c.schedule.Text)
+	s += fmt.Sprintf("  %-40s %12s\n", "next check at", next)
+	return s
+}
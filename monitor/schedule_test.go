@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronExpr(t *testing.T) {
+	e, err := parseCronExpr("*/10 8-18 * * 1-5")
+	require.NoError(t, err)
+	// Monday
+	monday := time.Date(2024, 6, 3, 8, 20, 0, 0, time.UTC)
+	assert.True(t, e.Matches(monday))
+	assert.False(t, e.Matches(monday.Add(5*time.Minute)))
+	assert.False(t, e.Matches(monday.Add(-time.Hour)))
+	// Saturday
+	assert.False(t, e.Matches(monday.AddDate(0, 0, 5)))
+
+	assert.Equal(t, monday.Add(10*time.Minute), e.Next(monday))
+	assert.Equal(t, monday.Add(10*time.Minute), e.Next(monday.Add(9*time.Minute+30*time.Second)))
+	// From Friday evening to Monday morning
+	friday := time.Date(2024, 6, 7, 18, 55, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 6, 10, 8, 0, 0, 0, time.UTC), e.Next(friday))
+
+	e, err = parseCronExpr("0 2 1,15 * 0")
+	require.NoError(t, err)
+	// Either the day of month or the day of week must match
+	assert.True(t, e.Matches(time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC)))
+	assert.True(t, e.Matches(time.Date(2024, 6, 2, 2, 0, 0, 0, time.UTC)))
+	assert.False(t, e.Matches(time.Date(2024, 6, 3, 2, 0, 0, 0, time.UTC)))
+
+	e, err = parseCronExpr("30 4 * 2 7")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 2, 2, 4, 30, 0, 0, time.UTC), e.Next(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)))
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := parseCronExpr(expr)
+		assert.Error(t, err, "Expected %q to fail", expr)
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	s, err := parseSchedule("every 5 cycles")
+	require.NoError(t, err)
+	assert.Equal(t, 5, s.Cycles)
+	assert.Nil(t, s.Cron)
+
+	s, err = parseSchedule(`not every "0 2 * * *"`)
+	require.NoError(t, err)
+	assert.True(t, s.Negated)
+	assert.NotNil(t, s.Cron)
+
+	c, err := newCheckFromData(`check process web with pidfile /tmp/web.pid
+  every "*/10 8-18 * * 1-5"
+  start program = "/bin/true"
+`)
+	require.NoError(t, err)
+	pc := c.(*ProcessCheck)
+	require.NotNil(t, pc.schedule)
+	assert.Equal(t, `every "*/10 8-18 * * 1-5"`, pc.schedule.Text)
+	assert.Equal(t, "/bin/true", pc.StartProgram.Cmd)
+
+	for _, statement := range []string{"every 0 cycles", "not every 2 cycles", `every "* * *"`} {
+		_, err := parseSchedule(statement)
+		assert.Error(t, err, "Expected %q to fail", statement)
+	}
+}
+
+func TestScheduleIsDue(t *testing.T) {
+	now := time.Date(2024, 6, 3, 8, 20, 0, 0, time.UTC)
+	s, _ := parseSchedule("every 3 cycles")
+	for i, expected := range []bool{true, false, false, true, false} {
+		assert.Equal(t, expected, s.isDue(now), "Unexpected result in cycle %d", i)
+	}
+	// Two cycles left after the current one
+	assert.Equal(t, now.Add(2*time.Minute), s.next(now, time.Minute))
+
+	s, _ = parseSchedule(`every "20 8 * * *"`)
+	assert.True(t, s.isDue(now))
+	// Only once per matching minute
+	assert.False(t, s.isDue(now.Add(30*time.Second)))
+	assert.False(t, s.isDue(now.Add(time.Minute)))
+	assert.True(t, s.isDue(now.AddDate(0, 0, 1)))
+	assert.Equal(t, now.AddDate(0, 0, 1), s.next(now, time.Minute))
+
+	s, _ = parseSchedule(`not every "20-21 8 * * *"`)
+	assert.False(t, s.isDue(now))
+	assert.True(t, s.isDue(now.Add(2*time.Minute)))
+	assert.Equal(t, now.Add(2*time.Minute), s.next(now, time.Minute))
+}
+
+func TestMonitorPerformSchedule(t *testing.T) {
+	app, err := New(Config{})
+	require.NoError(t, err)
+	dc := newDummyCheck("dummy")
+	require.NoError(t, app.AddCheck(dc))
+	dc.parseSchedule("every 2 cycles")
+	for i := 0; i < 4; i++ {
+		app.Perform()
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, 2, dc.getTimesCalled())
+
+	fc := newTestFileCheck(t, "/etc/hosts", "  every 3 cycles\n  if does not exist then alert\n")
+	require.NotNil(t, fc.schedule)
+	assert.Len(t, fc.rules, 1)
+	require.NoError(t, app.AddCheck(fc))
+	app.Perform()
+	assert.Regexp(t, regexp.MustCompile(`\n\s+schedule\s+every 3 cycles\n\s+next check at\s+\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\n\s+monitoring status`),
+		app.StatusText(fc.ID))
+}
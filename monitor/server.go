@@ -73,9 +73,9 @@ func (ms *monitorServer) formatResponse(fn func() (bool, string)) string {
 	return string(res)
 }
 
-func (ms *monitorServer) defineServiceCmdRoutes(router *httprouter.Router, id string, cb func(string) error, shouldSkip func(interface {
-	Checkable
-}) bool) {
+// defineServiceCmdRoutes defines the routes executing a command over a
+// service (cb) and over all of them (allCb)
+func (ms *monitorServer) defineServiceCmdRoutes(router *httprouter.Router, id string, cb func(string) error, allCb func() []error) {
 
 	router.POST(fmt.Sprintf("/%s/:service", id), func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		serviceName := ps.ByName("service")
@@ -94,14 +94,8 @@ func (ms *monitorServer) defineServiceCmdRoutes(router *httprouter.Router, id st
 		ms.logger.Debugf("[CLIENT_REQUEST] Requested execution of \"%s all\"", id)
 		fmt.Fprintln(w, ms.formatResponse(func() (bool, string) {
 			errMsgs := []string{}
-			for _, c := range ms.monitor.checks {
-				if shouldSkip(c) {
-					continue
-				}
-				err := cb(c.GetID())
-				if err != nil {
-					errMsgs = append(errMsgs, err.Error())
-				}
+			for _, err := range allCb() {
+				errMsgs = append(errMsgs, err.Error())
 			}
 			if len(errMsgs) > 0 {
 				return false, strings.Join(errMsgs, "\n")
@@ -125,60 +119,102 @@ func createServer(monitor *Monitor) *monitorServer {
 
 	router := httprouter.New()
 
-	for cmd, cb := range map[string]func(interface {
+	// takeOnceFor reserves c for an operation, so it never overlaps with
+	// other operations or with the monitor performing the same check
+	takeOnceFor := func(c interface {
 		CheckableProcess
-	}) error{
-		"start":   startProcess,
-		"stop":    stopProcess,
-		"restart": restartProcess,
+	}) (func(cb func()), error) {
+		timeout := c.GetTimeout() + (5 * time.Second)
+		run := takeOnce(c.GetUniqueID(), timeout, Opts{Logger: s.logger})
+		if run == nil {
+			return nil, fmt.Errorf("[%s] Other action already in progress -- please try again later", c.GetID())
+		}
+		return run, nil
+	}
+
+	// Restarting a single service also restarts its dependents, which is not
+	// needed when restarting all of them
+	for cmd, op := range map[string]struct {
+		cb, allCb func(interface {
+			CheckableProcess
+		}) error
+		forStop bool
+	}{
+		"start":   {startProcess, startProcess, false},
+		"stop":    {stopProcess, stopProcess, true},
+		"restart": {monitor.restartWithDependents, restartProcess, false},
 	} {
-		func(cb func(interface {
+		func(cb, allCb func(interface {
 			CheckableProcess
-		}) error) {
+		}) error, forStop bool) {
 			s.defineServiceCmdRoutes(router, cmd, func(id string) error {
 				c, err := monitor.findProcessCheck(id)
 				if err != nil {
 					return err
 				}
-				uid := c.GetUniqueID()
-				timeout := c.GetTimeout() + (5 * time.Second)
-				blocked := doOnce(uid, func() { cb(c) }, timeout, Opts{Logger: s.logger})
-				if blocked {
-					return fmt.Errorf("[%s] Other action already in progress -- please try again later", id)
+				run, err := takeOnceFor(c)
+				if err != nil {
+					return err
 				}
+				go run(func() { cb(c) })
 				return nil
-			}, func(e interface {
-				Checkable
-			}) bool {
-				_, ok := e.(CheckableProcess)
-				return !ok
+			}, func() []error {
+				// Every check is reserved right away, while the operations
+				// are performed in the background in dependency order
+				errs := []error{}
+				checks := []interface {
+					Checkable
+				}{}
+				runs := make(map[string]func(cb func()))
+				for _, c := range monitor.checks {
+					pc, ok := c.(interface {
+						CheckableProcess
+					})
+					if !ok {
+						continue
+					}
+					run, err := takeOnceFor(pc)
+					if err != nil {
+						errs = append(errs, err)
+						continue
+					}
+					checks = append(checks, c)
+					runs[c.GetID()] = run
+				}
+				err := runAfterDependencies(checks, forStop, func(c interface {
+					Checkable
+				}) {
+					runs[c.GetID()](func() { allCb(c.(CheckableProcess)) })
+				})
+				if err != nil {
+					s.logger.Warnf("Cannot sort services by their dependencies: %s", err.Error())
+				}
+				return errs
 			})
-		}(cb)
+		}(op.cb, op.allCb, op.forStop)
 	}
 
 	// monitor and unmonitor are synchronous
-	for cmd, cb := range map[string]func(interface {
-		Checkable
-	}) error{
-		"monitor":   monitor.monitorCheck,
-		"unmonitor": monitor.unmonitorCheck,
+	for cmd, op := range map[string]struct {
+		cb func(interface {
+			Checkable
+		}) error
+		allCb func() []error
+	}{
+		"monitor":   {monitor.monitorCheck, monitor.MonitorAll},
+		"unmonitor": {monitor.unmonitorCheck, monitor.UnmonitorAll},
 	} {
 		func(cb func(interface {
 			Checkable
-		}) error) {
+		}) error, allCb func() []error) {
 			s.defineServiceCmdRoutes(router, cmd, func(id string) error {
 				c := monitor.FindCheck(id)
 				if c == nil {
 					return fmt.Errorf("Cannot find check with id %s", id)
 				}
 				return cb(c)
-			}, func(e interface {
-				Checkable
-			}) bool {
-				_, ok := e.(Checkable)
-				return !ok
-			})
-		}(cb)
+			}, allCb)
+		}(op.cb, op.allCb)
 	}
 
 	for id, fn := range map[string]func(args ...string) string{
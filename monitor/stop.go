@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bitnami/gonit/utils"
+)
+
+// defaultStopGracePeriod is the time given to a process to exit after each
+// of the signals sent when escalating a stop
+const defaultStopGracePeriod = 5 * time.Second
+
+var (
+	stopSignalRe     = regexp.MustCompile(`stop\s+signal\s+([A-Za-z0-9]+)`)
+	stopEscalationRe = regexp.MustCompile(`stop\s+escalation(\s+with\s+grace\s+(\d+)\s+` + durationUnitPattern + `)?`)
+	signalNames      = map[string]syscall.Signal{
+		"HUP":   syscall.SIGHUP,
+		"INT":   syscall.SIGINT,
+		"QUIT":  syscall.SIGQUIT,
+		"KILL":  syscall.SIGKILL,
+		"USR1":  syscall.SIGUSR1,
+		"USR2":  syscall.SIGUSR2,
+		"TERM":  syscall.SIGTERM,
+		"CONT":  syscall.SIGCONT,
+		"STOP":  syscall.SIGSTOP,
+		"WINCH": syscall.SIGWINCH,
+	}
+)
+
+// ParseSignal returns the signal identified by name, with or without the
+// SIG prefix, or by number
+func ParseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 1 || n > 64 {
+			return 0, fmt.Errorf("Invalid signal number %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("Unknown signal %q", name)
+}
+
+// signalName returns the SIG prefixed name of sig
+func signalName(sig syscall.Signal) string {
+	for name, s := range signalNames {
+		if s == sig {
+			return "SIG" + name
+		}
+	}
+	return fmt.Sprintf("signal %d", int(sig))
+}
+
+// parseStopSignal configures the signal sent to stop the process from a
+// "stop signal" statement
+func (c *ProcessCheck) parseStopSignal(statement string) {
+	m := stopSignalRe.FindStringSubmatch(statement)
+	sig, err := ParseSignal(m[1])
+	if err != nil {
+		c.logger.Warnf("Ignoring stop signal for %s: %s", c.ID, err.Error())
+		return
+	}
+	c.StopSignal = sig
+}
+
+// parseStopEscalation enables the stop escalation from a "stop escalation"
+// statement, reading its optional grace period
+func (c *ProcessCheck) parseStopEscalation(statement string) {
+	m := stopEscalationRe.FindStringSubmatch(statement)
+	c.StopEscalation = true
+	if m[2] == "" {
+		return
+	}
+	grace, err := parseDuration(m[2], m[3])
+	if err != nil {
+		c.logger.Warnf("Ignoring stop escalation grace period for %s: %s", c.ID, err.Error())
+		return
+	}
+	c.StopGracePeriod = grace
+}
+
+// signalTarget returns the pid to signal to reach the whole process group of
+// pid, or pid itself if the group cannot be read or is the monitor one
+func signalTarget(pid int) (int, string) {
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid > 1 && pgid != syscall.Getpgrp() {
+		return -pgid, fmt.Sprintf("process group %d", pgid)
+	}
+	return pid, fmt.Sprintf("process %d", pid)
+}
+
+// escalateStop terminates the process group of pid, which is still running
+// after its stop timeout, by sending SIGTERM and, if it does not exit within
+// the grace period, SIGKILL. It returns the steps taken
+func (c *ProcessCheck) escalateStop(pid int) ([]string, error) {
+	steps := []string{fmt.Sprintf("still running after %v", c.StopProgram.Timeout)}
+	if pid <= 0 {
+		return steps, fmt.Errorf("Failed to stop %s: unknown pid", c.GetID())
+	}
+	grace := c.StopGracePeriod
+	if grace == 0 {
+		grace = defaultStopGracePeriod
+	}
+	target, targetText := signalTarget(pid)
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGKILL} {
+		c.logger.Warnf("%s is still running, sending %s to %s", c.GetID(), signalName(sig), targetText)
+		if err := syscall.Kill(target, sig); err != nil && err != syscall.ESRCH {
+			steps = append(steps, fmt.Sprintf("failed to send %s to %s: %s", signalName(sig), targetText, err.Error()))
+			continue
+		}
+		steps = append(steps, fmt.Sprintf("sent %s to %s", signalName(sig), targetText))
+		if utils.WaitUntil(c.IsNotRunning, grace) {
+			c.logger.Infof("%s stopped after sending %s", c.GetID(), signalName(sig))
+			return steps, nil
+		}
+	}
+	return steps, fmt.Errorf("Failed to stop %s: %s", c.GetID(), strings.Join(steps, ", "))
+}
+
+// StopReporter is implemented by the checks managers able to describe the
+// escalation steps taken by the last stop of a service
+type StopReporter interface {
+	StopReport(id string) string
+}
+
+// stopReport describes the escalation steps taken by the last stop, or
+// returns an empty string if the process stopped without escalating
+func (c *ProcessCheck) stopReport() string {
+	if steps := c.getStopSteps(); len(steps) > 0 {
+		return "escalated: " + strings.Join(steps, ", ")
+	}
+	return ""
+}
+
+// getStopSteps returns the escalation steps taken by the last stop
+func (c *ProcessCheck) getStopSteps() []string {
+	if steps, ok := c.stopSteps.Get().([]string); ok {
+		return steps
+	}
+	return []string{}
+}
+
+// stopText returns the status lines describing the stop settings and the
+// escalation steps taken by the last stop, if any
+func (c *ProcessCheck) stopText() string {
+	s := ""
+	if c.StopSignal != 0 {
+		s += fmt.Sprintf("  %-40s %12s\n", "stop signal", signalName(c.StopSignal))
+	}
+	if steps := c.getStopSteps(); len(steps) > 0 {
+		s += fmt.Sprintf("  %-40s %12s\n", "last stop escalation", strings.Join(steps, ", "))
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bitnami/gonit/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startProcessGroup runs script in its own process group, reaping it when
+// it exits so it is not reported as running, and writes its pid to pidFile
+func startProcessGroup(t *testing.T, script string, pidFile string) int {
+	cmd := exec.Command("/bin/bash", "-c", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	require.NoError(t, cmd.Start())
+	pid := cmd.Process.Pid
+	go cmd.Wait()
+	t.Cleanup(func() {
+		syscall.Kill(-pid, syscall.SIGKILL)
+	})
+	_, err := sb.Write(pidFile, strconv.Itoa(pid))
+	require.NoError(t, err)
+	return pid
+}
+
+func newTestStopProcessCheck(t *testing.T, pidFile string, settings string) *ProcessCheck {
+	return newTestCheck[*ProcessCheck](t, fmt.Sprintf("check process web with pidfile %s\n%s", pidFile, settings))
+}
+
+func TestParseSignal(t *testing.T) {
+	for name, expected := range map[string]syscall.Signal{
+		"TERM": syscall.SIGTERM, "SIGKILL": syscall.SIGKILL, "usr1": syscall.SIGUSR1, "2": syscall.SIGINT,
+	} {
+		sig, err := ParseSignal(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, sig)
+	}
+	for _, name := range []string{"FOO", "0", "65"} {
+		_, err := ParseSignal(name)
+		assert.Error(t, err, "Expected %q to fail", name)
+	}
+	assert.Equal(t, "SIGTERM", signalName(syscall.SIGTERM))
+}
+
+func TestParseStopSettings(t *testing.T) {
+	pc := newTestStopProcessCheck(t, "/tmp/web.pid", `  stop signal INT
+  stop escalation with grace 2 seconds
+  stop program = "/bin/true" with timeout 10 seconds
+`)
+	assert.Equal(t, syscall.SIGINT, pc.StopSignal)
+	assert.True(t, pc.StopEscalation)
+	assert.Equal(t, 2*time.Second, pc.StopGracePeriod)
+	assert.Equal(t, "/bin/true", pc.StopProgram.Cmd)
+	assert.Equal(t, 10*time.Second, pc.StopProgram.Timeout)
+
+	pc = newTestStopProcessCheck(t, "/tmp/web.pid", "  stop escalation\n")
+	assert.True(t, pc.StopEscalation)
+	assert.Equal(t, time.Duration(0), pc.StopGracePeriod)
+}
+
+func TestProcessCheckStopSignal(t *testing.T) {
+	pidFile := sb.TempFile()
+	pc := newTestStopProcessCheck(t, pidFile, "  stop signal INT\n  with timeout 2 seconds\n")
+	startProcessGroup(t, "exec sleep 30", pidFile)
+	require.True(t, pc.IsRunning())
+	require.NoError(t, pc.Stop())
+	assert.False(t, pc.IsRunning())
+	assert.Regexp(t, regexp.MustCompile(`\n\s+stop signal\s+SIGINT\n`), pc.String())
+}
+
+func TestProcessCheckStopEscalation(t *testing.T) {
+	pidFile := sb.TempFile()
+	// Without escalation, the process is left running
+	pc := newTestStopProcessCheck(t, pidFile, `  stop program = "/bin/true" with timeout 500 milliseconds
+`)
+	pid := startProcessGroup(t, "sleep 30", pidFile)
+	assert.EqualError(t, pc.Stop(), "Failed to stop web")
+	assert.True(t, pc.IsRunning())
+
+	// The process group gets terminated
+	pc = newTestStopProcessCheck(t, pidFile, `  stop program = "/bin/true" with timeout 500 milliseconds
+  stop escalation with grace 1 second
+`)
+	require.NoError(t, pc.Stop())
+	assert.False(t, pc.IsRunning())
+	assert.Equal(t, []string{"still running after 500ms", fmt.Sprintf("sent SIGTERM to process group %d", pid)}, pc.getStopSteps())
+
+	// Processes ignoring SIGTERM are killed
+	pid = startProcessGroup(t, `trap "" TERM; sleep 30 & wait`, pidFile)
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, pc.Stop())
+	assert.False(t, pc.IsRunning())
+	assert.Equal(t, []string{
+		"still running after 500ms",
+		fmt.Sprintf("sent SIGTERM to process group %d", pid),
+		fmt.Sprintf("sent SIGKILL to process group %d", pid),
+	}, pc.getStopSteps())
+	assert.Regexp(t, regexp.MustCompile(`\n\s+last stop escalation\s+still running after 500ms, sent SIGTERM .*, sent SIGKILL .*\n`), pc.String())
+}
+
+func TestProcessCheckStopProgramTimeout(t *testing.T) {
+	pidFile, stopperPidFile := sb.TempFile(), sb.TempFile()
+	pc := newTestStopProcessCheck(t, pidFile, fmt.Sprintf(`  stop program = "echo $$ > %s; exec sleep 30" with timeout 500 milliseconds
+  stop escalation with grace 1 second
+`, stopperPidFile))
+	startProcessGroup(t, "sleep 30", pidFile)
+	require.NoError(t, pc.Stop())
+	stopperPid, err := utils.ReadPid(stopperPidFile)
+	require.NoError(t, err)
+	// The hung stop program gets its process group killed too
+	assert.True(t, utils.WaitUntil(func() bool {
+		return !utils.IsProcessRunning(stopperPid)
+	}, 2*time.Second), "Expected the stop program to be killed")
+}
+
+func TestStopReport(t *testing.T) {
+	pidFile := sb.TempFile()
+	ctrlFile, err := sb.WriteFile(sb.TempFile(), []byte(fmt.Sprintf(`check process web with pidfile %s
+  stop program = "/bin/true" with timeout 500 milliseconds
+  stop escalation with grace 1 second
+`, pidFile)), os.FileMode(0600))
+	require.NoError(t, err)
+	app, err := New(Config{ControlFile: ctrlFile, SocketFile: sb.TempFile(), StateFile: sb.TempFile()})
+	require.NoError(t, err)
+	require.NoError(t, app.StartServer())
+	defer app.Terminate()
+	cm := NewClient(app.SocketFile)
+
+	// The daemon reports the escalation steps in the status of the service
+	pid := startProcessGroup(t, "sleep 30", pidFile)
+	require.NoError(t, cm.Stop("web"))
+	require.True(t, utils.WaitUntil(func() bool {
+		return strings.Contains(cm.StatusText("web"), "last stop escalation")
+	}, 5*time.Second), "Expected the status to report the stop escalation")
+	assert.Regexp(t, fmt.Sprintf(`last stop escalation\s+still running after 500ms, sent SIGTERM to process group %d\n`, pid), cm.StatusText("web"))
+	assert.Equal(t, fmt.Sprintf("escalated: still running after 500ms, sent SIGTERM to process group %d", pid), app.StopReport("web"))
+
+	// Stops not needing escalation do not report anything
+	sb.Write(pidFile, "")
+	require.NoError(t, app.Stop("web"))
+	assert.Equal(t, "", app.StopReport("web"))
+}
@@ -0,0 +1,332 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	loadavgCondRe    = regexp.MustCompile(`^loadavg\s*\(?\s*(1|5|15)\s*min\s*\)?\s+` + operatorPattern + `\s+([0-9.]+)$`)
+	cpuCondRe        = regexp.MustCompile(`^cpu(\s+(usage|user|system|wait))?\s+` + operatorPattern + `\s+([0-9.]+)\s*%$`)
+	memoryCondRe     = regexp.MustCompile(`^(memory|swap)(\s+(usage|free))?\s+` + operatorPattern + `\s+([0-9.]+)\s*(%|` + sizeUnitPattern + `)?$`)
+	loadavgIntervals = []string{"1min", "5min", "15min"}
+)
+
+// cpuTimes contains the cumulative CPU times read from /proc/stat
+type cpuTimes struct {
+	User   float64
+	System float64
+	Idle   float64
+	Wait   float64
+	Total  float64
+}
+
+// systemStats contains the host-wide resource usage
+type systemStats struct {
+	// Load contains the 1, 5 and 15 minutes load averages
+	Load [3]float64
+	// CPUUser, CPUSystem and CPUWait contain the percentage of CPU time
+	// spent in each state since the previous cycle, or -1 if unknown
+	CPUUser     float64
+	CPUSystem   float64
+	CPUWait     float64
+	MemoryTotal float64
+	MemoryFree  float64
+	SwapTotal   float64
+	SwapFree    float64
+}
+
+// CPUUsage returns the percentage of CPU time spent in user and system states
+func (s *systemStats) CPUUsage() float64 {
+	if s.CPUUser < 0 {
+		return -1
+	}
+	return s.CPUUser + s.CPUSystem
+}
+
+// MemoryUsed returns the number of bytes of memory in use
+func (s *systemStats) MemoryUsed() float64 {
+	return s.MemoryTotal - s.MemoryFree
+}
+
+// SwapUsed returns the number of bytes of swap in use
+func (s *systemStats) SwapUsed() float64 {
+	return s.SwapTotal - s.SwapFree
+}
+
+func readLoadavg() ([3]float64, error) {
+	load := [3]float64{}
+	data, err := os.ReadFile(filepath.Join(procDir, "loadavg"))
+	if err != nil {
+		return load, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("Malformed loadavg data %q", string(data))
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, err
+		}
+	}
+	return load, nil
+}
+
+func readCPUTimes() (*cpuTimes, error) {
+	fh, err := os.Open(filepath.Join(procDir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[0] != "cpu" {
+			continue
+		}
+		// user nice system idle iowait irq softirq steal...
+		values := make([]float64, len(fields)-1)
+		for i, f := range fields[1:] {
+			if values[i], err = strconv.ParseFloat(f, 64); err != nil {
+				return nil, err
+			}
+		}
+		t := &cpuTimes{
+			User:   values[0] + values[1],
+			System: values[2] + values[5] + values[6],
+			Idle:   values[3],
+			Wait:   values[4],
+		}
+		// Guest times are already accounted in user times
+		for _, v := range values[:min(len(values), 8)] {
+			t.Total += v
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("Cannot find cpu times in %s", fh.Name())
+}
+
+func readMeminfo() (map[string]float64, error) {
+	return readProcValues(filepath.Join(procDir, "meminfo"))
+}
+
+// SystemCheck defines a check monitoring the load, CPU, memory and swap
+// usage of the host
+type SystemCheck struct {
+	*check
+	stats     syncValue
+	lastCPU   syncValue
+	checkedAt syncTime
+}
+
+func newSystemCheck(c *check) *SystemCheck {
+	return &SystemCheck{check: c}
+}
+
+func (c *SystemCheck) getStats() *systemStats {
+	if stats, ok := c.stats.Get().(*systemStats); ok {
+		return stats
+	}
+	return nil
+}
+
+func (c *SystemCheck) collectStats() (*systemStats, error) {
+	stats := &systemStats{CPUUser: -1, CPUSystem: -1, CPUWait: -1}
+	var err error
+	if stats.Load, err = readLoadavg(); err != nil {
+		return nil, err
+	}
+
+	cpu, err := readCPUTimes()
+	if err != nil {
+		return nil, err
+	}
+	// CPU percentages are computed from the times elapsed between cycles
+	if previous, ok := c.lastCPU.Get().(*cpuTimes); ok {
+		if delta := cpu.Total - previous.Total; delta > 0 {
+			stats.CPUUser = percent(cpu.User-previous.User, delta)
+			stats.CPUSystem = percent(cpu.System-previous.System, delta)
+			stats.CPUWait = percent(cpu.Wait-previous.Wait, delta)
+		}
+	}
+	c.lastCPU.Set(cpu)
+
+	info, err := readMeminfo()
+	if err != nil {
+		return nil, err
+	}
+	stats.MemoryTotal = info["MemTotal"]
+	if available, ok := info["MemAvailable"]; ok {
+		stats.MemoryFree = available
+	} else {
+		stats.MemoryFree = info["MemFree"] + info["Buffers"] + info["Cached"]
+	}
+	stats.SwapTotal = info["SwapTotal"]
+	stats.SwapFree = info["SwapFree"]
+	return stats, nil
+}
+
+func (c *SystemCheck) getStatusString() (str string) {
+	switch {
+	case !c.IsMonitored():
+		str = c.getMonitoredString()
+	case c.checkedAt.Get().Equal(time.Time{}):
+		str = "Initializing"
+	case c.getStats() == nil:
+		str = "Data access error"
+	case c.failedRule() != nil:
+		str = c.failedRule().Condition.Failure
+	default:
+		str = "OK"
+	}
+	return str
+}
+
+// SummaryText returns a string the a short summary of the check status:
+// System id       OK
+func (c *SystemCheck) SummaryText() string {
+	return fmt.Sprintf("System %-10s%40s", c.ID, c.getStatusString())
+}
+
+func formatUsage(used, total float64) string {
+	return fmt.Sprintf("%s [%.1f%%]", formatSize(used), percent(used, total))
+}
+
+// String returns a string representation for the system check
+func (c *SystemCheck) String() string {
+	s := fmt.Sprintf("System '%s'\n", c.ID)
+	if c.IsMonitored() {
+		s += fmt.Sprintf("  %-40s %12s\n", "status", c.getStatusString())
+		if stats := c.getStats(); stats != nil {
+			s += fmt.Sprintf("  %-40s %12s\n", "load average",
+				fmt.Sprintf("[%.2f] [%.2f] [%.2f]", stats.Load[0], stats.Load[1], stats.Load[2]))
+			cpu := "-"
+			if stats.CPUUsage() >= 0 {
+				cpu = fmt.Sprintf("%.1f%%us %.1f%%sy %.1f%%wa", stats.CPUUser, stats.CPUSystem, stats.CPUWait)
+			}
+			s += fmt.Sprintf("  %-40s %12s\n", "cpu", cpu)
+			s += fmt.Sprintf("  %-40s %12s\n", "memory usage", formatUsage(stats.MemoryUsed(), stats.MemoryTotal))
+			s += fmt.Sprintf("  %-40s %12s\n", "swap usage", formatUsage(stats.SwapUsed(), stats.SwapTotal))
+		}
+		s += c.rulesText()
+		s += c.scheduleText()
+		s += c.modeText()
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "monitored")
+	} else {
+		s += fmt.Sprintf("  %-40s %12s\n", "monitoring status", "Not monitored")
+	}
+	return s
+}
+
+// Perform makes the system check collect the current resource usage
+// and evaluate all of its conditions
+func (c *SystemCheck) Perform() {
+	c.logger.Infof("Performing system check %s", c.ID)
+	if stats, err := c.collectStats(); err != nil {
+		c.logger.Warnf("Error reading system information for %s: %s", c.ID, err.Error())
+		c.stats.Set(nil)
+	} else {
+		c.stats.Set(stats)
+	}
+	c.checkedAt.Set(time.Now())
+	c.evaluateRules()
+	c.logger.MDebugf(c.String())
+}
+
+// Parse reads a string containing a monit-like system configuration text
+// and loads the specified settings
+func (c *SystemCheck) Parse(data string) {
+	c.parseStatements(data, c.parseCondition, func(kind, value string) bool {
+		return false
+	})
+}
+
+func (c *SystemCheck) parseCondition(text string) (*condition, error) {
+	switch {
+	case loadavgCondRe.MatchString(text):
+		m := loadavgCondRe.FindStringSubmatch(text)
+		interval, op := m[1]+"min", m[2]
+		limit, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			return nil, err
+		}
+		idx := 0
+		for i, name := range loadavgIntervals {
+			if name == interval {
+				idx = i
+			}
+		}
+		return &condition{Text: text, Failure: "Loadavg failed", test: func() (bool, string) {
+			stats := c.getStats()
+			if stats == nil {
+				return false, ""
+			}
+			return compare(op, stats.Load[idx], limit),
+				fmt.Sprintf("loadavg (%s) test failed -- current loadavg is %.2f", interval, stats.Load[idx])
+		}}, nil
+	case cpuCondRe.MatchString(text):
+		m := cpuCondRe.FindStringSubmatch(text)
+		measure, op := m[2], m[3]
+		if measure == "" {
+			measure = "usage"
+		}
+		limit, err := strconv.ParseFloat(m[4], 64)
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Text: text, Failure: "CPU usage failed", test: func() (bool, string) {
+			stats := c.getStats()
+			if stats == nil || stats.CPUUsage() < 0 {
+				return false, ""
+			}
+			current := map[string]float64{
+				"usage":  stats.CPUUsage(),
+				"user":   stats.CPUUser,
+				"system": stats.CPUSystem,
+				"wait":   stats.CPUWait,
+			}[measure]
+			return compare(op, current, limit), fmt.Sprintf("cpu %s test failed -- current cpu %s is %.1f%%", measure, measure, current)
+		}}, nil
+	case memoryCondRe.MatchString(text):
+		m := memoryCondRe.FindStringSubmatch(text)
+		resource, measure, op, unit := m[1], m[3], m[4], m[6]
+		if measure == "" {
+			measure = "usage"
+		}
+		sizeUnit := unit
+		if unit == "%" {
+			sizeUnit = ""
+		}
+		limit, err := parseSize(m[5], sizeUnit)
+		if err != nil {
+			return nil, err
+		}
+		failure := fmt.Sprintf("%s%s %s failed", strings.ToUpper(resource[0:1]), resource[1:], measure)
+		return &condition{Text: text, Failure: failure, test: func() (bool, string) {
+			stats := c.getStats()
+			if stats == nil {
+				return false, ""
+			}
+			total, value := stats.MemoryTotal, stats.MemoryFree
+			if resource == "swap" {
+				total, value = stats.SwapTotal, stats.SwapFree
+			}
+			if measure == "usage" {
+				value = total - value
+			}
+			current := value
+			if unit == "%" {
+				current = percent(value, total)
+			}
+			return compare(op, current, limit), fmt.Sprintf("%s %s test failed -- current %s %s is %s",
+				resource, measure, resource, measure, formatUsage(value, total))
+		}}, nil
+	}
+	return nil, fmt.Errorf("Unknown condition %q", text)
+}
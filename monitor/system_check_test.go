@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSystemCheck(t *testing.T, rules string) *SystemCheck {
+	return newTestCheck[*SystemCheck](t, "check system myhost\n"+rules)
+}
+
+// writeFakeProc populates dir with the provided proc files
+func writeFakeProc(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		_, err := sb.WriteFile(filepath.Join(dir, name), []byte(content), os.FileMode(0644))
+		require.NoError(t, err)
+	}
+}
+
+func TestSystemCheckParse(t *testing.T) {
+	sc := newTestSystemCheck(t, `
+  if loadavg (5min) > 4 then alert
+  if loadavg(1min) > 8 then alert
+  if cpu usage > 95% then alert
+  if cpu wait > 20% then alert
+  if memory usage > 90% then alert
+  if swap usage > 1 GB then alert
+  if cpu usage > 95 GB then alert
+`)
+	assert.Len(t, sc.rules, 6)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	c, err := newCheckFromData("check system $HOST")
+	require.NoError(t, err)
+	assert.Equal(t, hostname, c.GetID())
+}
+
+func TestSystemCheckConditions(t *testing.T) {
+	defer func(d string) { procDir = d }(procDir)
+	procDir, _ = sb.Mkdir(sb.TempFile(), os.FileMode(0755))
+	writeFakeProc(t, procDir, map[string]string{
+		"loadavg": "0.50 4.50 2.00 2/107 19535\n",
+		"stat":    "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 100 0 100 700 100 0 0 0 0 0\n",
+		"meminfo": "MemTotal:        1048576 kB\nMemFree:          10240 kB\nMemAvailable:     102400 kB\n" +
+			"SwapTotal:        1048576 kB\nSwapFree:         1048576 kB\n",
+	})
+
+	sc := newTestSystemCheck(t, `
+  if loadavg (5min) > 4 then alert
+  if loadavg (15min) > 4 then alert
+  if cpu usage > 50% then alert
+  if memory usage > 90% then alert
+  if swap usage > 1 MB then alert
+`)
+	assert.Equal(t, "Initializing", sc.getStatusString())
+	sc.Perform()
+	stats := sc.getStats()
+	require.NotNil(t, stats)
+	assert.Equal(t, [3]float64{0.5, 4.5, 2}, stats.Load)
+	// CPU usage is unknown until the second cycle
+	assert.Equal(t, float64(-1), stats.CPUUsage())
+	assert.Equal(t, float64(1024*1024*1024), stats.MemoryTotal)
+	assert.Equal(t, float64(100*1024*1024), stats.MemoryFree)
+	for i, expected := range []bool{true, false, false, true, false} {
+		assert.Equal(t, expected, sc.rules[i].matched.Get(), "Unexpected result for %q", sc.rules[i].Condition)
+	}
+	assert.Equal(t, "Loadavg failed", sc.getStatusString())
+
+	writeFakeProc(t, procDir, map[string]string{
+		"stat": "cpu  400 0 200 700 200 0 0 0 0 0\n",
+	})
+	sc.Perform()
+	stats = sc.getStats()
+	assert.InDelta(t, 60, stats.CPUUser, 0.001)
+	assert.InDelta(t, 20, stats.CPUSystem, 0.001)
+	assert.InDelta(t, 20, stats.CPUWait, 0.001)
+	assert.True(t, sc.rules[2].matched.Get())
+
+	assert.Regexp(t, regexp.MustCompile(`^System myhost\s+Loadavg failed$`), sc.SummaryText())
+	assert.Regexp(t, regexp.MustCompile(
+		`^System 'myhost'\n\s+status\s+Loadavg failed\n\s+load average\s+\[0.50\] \[4.50\] \[2.00\]\n`+
+			`\s+cpu\s+60.0%us 20.0%sy 20.0%wa\n\s+memory usage\s+924.0 MB \[90.2%\]\n`+
+			`\s+swap usage\s+0 B \[0.0%\]\n\s+rule 'loadavg \(5min\) > 4'\s+failed\n`+
+			`\s+rule 'loadavg \(15min\) > 4'\s+ok\n\s+rule 'cpu usage > 50%'\s+failed\n\s+rule 'memory usage > 90%'\s+failed\n`+
+			`\s+rule 'swap usage > 1 MB'\s+ok\n\s+monitoring status\s+monitored\n$`,
+	), sc.String())
+
+	os.Remove(filepath.Join(procDir, "meminfo"))
+	sc.Perform()
+	assert.Equal(t, "Data access error", sc.getStatusString())
+}
@@ -6,6 +6,12 @@ import (
 	"github.com/bitnami/gonit/log"
 )
 
+// validatableCheck defines the interface of the checks whose settings
+// must be verified before loading them
+type validatableCheck interface {
+	validate() error
+}
+
 type configValidator struct {
 	SettingsDatabase map[string]string
 	Success          bool
@@ -31,6 +37,10 @@ func (cv *configValidator) SetAttribute(key, value string) {
 	if cv.SettingsDatabase == nil {
 		cv.SettingsDatabase = map[string]string{}
 	}
+	if key == "onreboot" && !isOnRebootPolicy(value) {
+		cv.Logger.Printf("Invalid onreboot policy %q", value)
+		cv.Success = false
+	}
 	cv.SettingsDatabase[key] = value
 }
 
@@ -45,6 +55,41 @@ func (cv *configValidator) FindCheck(id string) *interface {
 	return nil
 }
 
+// validateDependencies ensures all the check dependencies exist and
+// do not form cycles
+func (cv *configValidator) validateDependencies() error {
+	if _, err := sortChecks(cv.Checks); err != nil {
+		cv.Logger.Printf(err.Error())
+		cv.Success = false
+		return err
+	}
+	return nil
+}
+
+// validate parses the control file f, validating its settings, its checks
+// and the dependencies between them. It returns the first error found
+func (cv *configValidator) validate(f string) error {
+	if err := new(configParser).ParseConfigFile(f, cv, cv.Logger); err != nil {
+		cv.Success = false
+		return err
+	}
+	if err := cv.validateDependencies(); err != nil {
+		return err
+	}
+	if !cv.Success {
+		return fmt.Errorf("Invalid configuration file %s", f)
+	}
+	return nil
+}
+
+// ValidateConfigFile returns an error if the control file f is not valid,
+// reporting the issues found through logger
+func ValidateConfigFile(f string, logger Logger) error {
+	cv := newValidator()
+	cv.Logger = logger
+	return cv.validate(f)
+}
+
 func (cv *configValidator) AddCheck(c interface {
 	Checkable
 }) error {
@@ -54,6 +99,13 @@ func (cv *configValidator) AddCheck(c interface {
 		cv.Success = false
 		return err
 	}
+	if vc, ok := c.(validatableCheck); ok {
+		if err := vc.validate(); err != nil {
+			cv.Logger.Printf(err.Error())
+			cv.Success = false
+			return err
+		}
+	}
 	cv.Checks = append(cv.Checks, c)
 	return nil
 }
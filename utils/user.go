@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// LookupUser returns the user identified by name, which can be either a user
+// name or a numeric id. Names take precedence over ids
+func LookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return nil, fmt.Errorf("Unknown user '%s'", name)
+		}
+	}
+	return u, nil
+}
+
+// LookupGroup returns the group identified by name, which can be either a
+// group name or a numeric id. Names take precedence over ids
+func LookupGroup(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		if g, err = user.LookupGroupId(name); err != nil {
+			return nil, fmt.Errorf("Unknown group '%s'", name)
+		}
+	}
+	return g, nil
+}
+
+// LookupUID returns the numeric id of the user identified by name, which can
+// be either a user name or a numeric id
+func LookupUID(name string) (int, error) {
+	u, err := LookupUser(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// LookupGID returns the numeric id of the group identified by name, which can
+// be either a group name or a numeric id
+func LookupGID(name string) (int, error) {
+	g, err := LookupGroup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(g.Gid)
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+
+	tu "github.com/bitnami/gonit/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupUID(t *testing.T) {
+	for _, name := range []string{"root", "0"} {
+		uid, err := LookupUID(name)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, uid, "Expected '%s' to resolve to uid 0", name)
+	}
+	_, err := LookupUID("nonexistentuser1234")
+	tu.AssertErrorMatch(t, err, regexp.MustCompile("Unknown user 'nonexistentuser1234'"))
+}
+
+func TestLookupGID(t *testing.T) {
+	for _, name := range []string{"root", "0"} {
+		gid, err := LookupGID(name)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, gid, "Expected '%s' to resolve to gid 0", name)
+	}
+	_, err := LookupGID("nonexistentgroup1234")
+	tu.AssertErrorMatch(t, err, regexp.MustCompile("Unknown group 'nonexistentgroup1234'"))
+}
+
+func TestLookupUser(t *testing.T) {
+	for _, name := range []string{"root", "0"} {
+		u, err := LookupUser(name)
+		assert.NoError(t, err)
+		assert.Equal(t, "0", u.Uid, "Expected '%s' to resolve to uid 0", name)
+	}
+	_, err := LookupUser("nonexistentuser1234")
+	tu.AssertErrorMatch(t, err, regexp.MustCompile("Unknown user 'nonexistentuser1234'"))
+}
+
+func TestLookupGroup(t *testing.T) {
+	for _, name := range []string{"root", "0"} {
+		g, err := LookupGroup(name)
+		assert.NoError(t, err)
+		assert.Equal(t, "0", g.Gid, "Expected '%s' to resolve to gid 0", name)
+	}
+	_, err := LookupGroup("nonexistentgroup1234")
+	tu.AssertErrorMatch(t, err, regexp.MustCompile("Unknown group 'nonexistentgroup1234'"))
+}